@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sylr/cerberus/config"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+	qdconfig "github.com/sylr/go-libqd/config"
+)
+
+// configValidateOptions are the options of `cerberus config validate`
+type configValidateOptions struct {
+	File           string `short:"f" long:"config" required:"true" description:"Config file to validate"`
+	ResolveSecrets bool   `long:"resolve-secrets" description:"Resolve secret references from the environment and files"`
+	Strict         bool   `long:"strict" description:"Reject unknown keys"`
+}
+
+// configCommand implements `cerberus config <subcommand>` and returns the exit
+// code.
+func configCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: cerberus config validate -f <file> | cerberus config schema\n")
+		return 2
+	}
+
+	switch args[0] {
+	case "validate":
+		return configValidateCommand(args[1:])
+	case "schema":
+		return configSchemaCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config subcommand `%s`\n", args[0])
+		return 2
+	}
+}
+
+// configValidateCommand loads a config file and runs the validators against it
+// without starting anything. Errors are printed prefixed by the file name and,
+// for YAML files, the line of the offending key.
+func configValidateCommand(args []string) int {
+	opts := configValidateOptions{}
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.Name = "cerberus config validate"
+
+	if _, err := parser.ParseArgs(args); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return 0
+		}
+
+		return 2
+	}
+
+	conf := &config.Cerberus{File: opts.File, Strict: opts.Strict}
+	content, err := config.LoadFile(conf, opts.File)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	safe := &config.Safe{Logger: log.StandardLogger()}
+	validators := safe.ConfigValidators()
+
+	if opts.ResolveSecrets {
+		validators = append([]qdconfig.Validator{safe.SecretsValidator}, validators...)
+	}
+
+	var errs []error
+
+	for _, validator := range validators {
+		errs = append(errs, validator(nil, conf)...)
+	}
+
+	for _, err := range errs {
+		var pathErr *config.PathError
+		line := 0
+
+		if errors.As(err, &pathErr) && config.IsYAMLFile(opts.File) {
+			line = config.YAMLLine(content, pathErr.Path)
+		}
+
+		if line > 0 {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", opts.File, line, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", opts.File, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return 1
+	}
+
+	fmt.Printf("%s: configuration is valid\n", opts.File)
+
+	return 0
+}
+
+// configSchemaCommand prints the JSON Schema of the config file.
+func configSchemaCommand(args []string) int {
+	out, err := json.MarshalIndent(config.Schema(), "", "  ")
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s\n", out)
+
+	return 0
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/sylr/cerberus/config"
+	slackevents "github.com/sylr/cerberus/pkg/http/handlers/slack/events"
+	"github.com/sylr/cerberus/pkg/membership"
+	"github.com/sylr/cerberus/pkg/slack"
+	"github.com/sylr/cerberus/pkg/slack/fake"
+	"github.com/sylr/cerberus/pkg/state"
+	"github.com/sylr/cerberus/pkg/throttle"
+	"github.com/sylr/cerberus/pkg/tracing"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+	goslackevents "github.com/slack-go/slack/slackevents"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+)
+
+// replayOptions are the options of `cerberus replay`
+type replayOptions struct {
+	File     string `short:"f" long:"config" description:"Config file"`
+	Fixtures string `long:"fixtures" description:"JSON file mapping Slack API methods to fake responses"`
+	Live     bool   `long:"live" description:"Forward read-only calls to Slack, other calls are suppressed"`
+	Trace    bool   `long:"trace" description:"Print the spans of each event to stderr"`
+	Verbose  []bool `short:"v" long:"verbose" description:"Show verbose debug information"`
+	Args     struct {
+		Events string `positional-arg-name:"events.jsonl"`
+	} `positional-args:"true" required:"true"`
+}
+
+// replayCommand feeds recorded Events API envelopes, one per line, through the
+// same dispatch as the events handler and prints the decision of every action.
+// Slack is either faked from fixtures or only queried with read-only calls.
+func replayCommand(args []string) int {
+	opts := replayOptions{}
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.Name = "cerberus replay"
+
+	if _, err := parser.ParseArgs(args); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return 0
+		}
+
+		return 2
+	}
+
+	log.SetOutput(os.Stderr)
+
+	if len(opts.Verbose) > 0 {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	// Configuration
+	conf := &config.Cerberus{}
+
+	if len(opts.File) > 0 {
+		if _, err := config.LoadFile(conf, opts.File); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+
+		safe := &config.Safe{Logger: log.StandardLogger()}
+		var errs []error
+
+		for _, validator := range safe.DefaultValidators() {
+			errs = append(errs, validator(nil, conf)...)
+		}
+
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", opts.File, err)
+		}
+
+		if len(errs) > 0 {
+			return 1
+		}
+	}
+
+	// Slack backend
+	var transport *fake.Transport
+
+	if opts.Live {
+		transport = fake.NewReadOnly(http.DefaultTransport)
+	} else {
+		fixtures := make(map[string]json.RawMessage)
+
+		if len(opts.Fixtures) > 0 {
+			var err error
+			fixtures, err = fake.LoadFixtures(opts.Fixtures)
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+		}
+
+		transport = fake.New(fixtures)
+	}
+
+	// Tracing
+	if opts.Trace {
+		tracer := tracing.New(log.StandardLogger())
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+
+		if err == nil {
+			err = tracer.UseExporter(context.Background(), exporter)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+
+		defer tracer.Shutdown(context.Background())
+	}
+
+	// Throttling, counted in memory
+	store, _ := state.New("", log.StandardLogger())
+	thr := throttle.New(log.StandardLogger(), store)
+	thr.Apply(conf.Throttle)
+
+	// Every client, including the ones created by actions, goes through transport
+	slack.BaseTransport = transport
+	slackClient := slack.NewClient(&conf.Slack)
+	mem := membership.New(log.StandardLogger())
+
+	if err := mem.Load(context.Background(), conf); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	handler := slackevents.NewHandler(conf, log.StandardLogger(), slackClient, nil, nil, nil, thr, mem)
+
+	// Events
+	file, err := os.Open(opts.Args.Events)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	defer file.Close()
+
+	code := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		eventsAPIEvent, err := goslackevents.ParseEvent(json.RawMessage(scanner.Bytes()), goslackevents.OptionNoVerifyToken())
+
+		if err != nil {
+			fmt.Printf("%d: error: %v\n", line, err)
+			code = 1
+			continue
+		}
+
+		if eventsAPIEvent.Type != goslackevents.CallbackEvent {
+			fmt.Printf("%d: skipped %s\n", line, eventsAPIEvent.Type)
+			continue
+		}
+
+		eventID := ""
+		if callback, ok := eventsAPIEvent.Data.(*goslackevents.EventsAPICallbackEvent); ok {
+			eventID = callback.EventID
+		}
+
+		fmt.Printf("%d: %s event_id=%s\n", line, eventsAPIEvent.InnerEvent.Type, eventID)
+
+		decisions := handler.Dispatch(context.Background(), eventsAPIEvent)
+
+		if len(decisions) == 0 {
+			fmt.Printf("  no action\n")
+		}
+
+		for _, decision := range decisions {
+			if decision.Err != nil {
+				fmt.Printf("  %s: actionned=%t error=%v\n", decision.Action, decision.Actionned, decision.Err)
+			} else {
+				fmt.Printf("  %s: actionned=%t\n", decision.Action, decision.Actionned)
+			}
+		}
+
+		for _, call := range transport.Calls() {
+			fmt.Printf("  slack %s\n", call)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	return code
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/membership"
+	"github.com/sylr/cerberus/pkg/slack"
+	"github.com/sylr/cerberus/pkg/usergroups"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+// usergroupsOptions are the options of `cerberus usergroups plan|apply`
+type usergroupsOptions struct {
+	File string `short:"f" long:"config" required:"true" description:"Config file declaring the usergroups"`
+}
+
+// usergroupsCommand implements `cerberus usergroups <subcommand>` and returns
+// the exit code. plan prints the changes syncing Slack with the declared
+// usergroups, apply makes them regardless of dry_run.
+func usergroupsCommand(args []string) int {
+	if len(args) == 0 || (args[0] != "plan" && args[0] != "apply") {
+		fmt.Fprintf(os.Stderr, "Usage: cerberus usergroups plan|apply -f <file>\n")
+		return 2
+	}
+
+	opts := usergroupsOptions{}
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.Name = "cerberus usergroups " + args[0]
+
+	if _, err := parser.ParseArgs(args[1:]); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return 0
+		}
+
+		return 2
+	}
+
+	log.SetOutput(os.Stderr)
+
+	// Configuration
+	conf := &config.Cerberus{}
+
+	if _, err := config.LoadFile(conf, opts.File); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	safe := &config.Safe{Logger: log.StandardLogger()}
+	var errs []error
+
+	for _, validator := range safe.DefaultValidators() {
+		errs = append(errs, validator(nil, conf)...)
+	}
+
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", opts.File, err)
+	}
+
+	if len(errs) > 0 {
+		return 1
+	}
+
+	if conf.UserGroups == nil {
+		fmt.Fprintf(os.Stderr, "%s: no usergroups section\n", opts.File)
+		return 1
+	}
+
+	// Plan
+	ctx := context.Background()
+	client := slack.NewClient(&conf.Slack)
+	provider := membership.New(log.StandardLogger())
+
+	if err := provider.Load(ctx, conf); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	ctx = membership.WithProvider(ctx, provider)
+	plan, err := usergroups.NewPlan(ctx, client, conf.UserGroups)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	fmt.Println(plan.String())
+
+	if args[0] == "plan" || plan.Empty() {
+		return 0
+	}
+
+	// Apply
+	applied, err := usergroups.Apply(ctx, client, plan, log.StandardLogger())
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%d usergroups synced\n", applied)
+
+	return 0
+}
@@ -1,10 +1,27 @@
 package config
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 	qdconfig "github.com/sylr/go-libqd/config"
 )
@@ -23,17 +40,53 @@ var (
 		},
 		[]string{},
 	)
+
+	metricConfigLastReloadSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "config",
+			Name:      "last_reload_success",
+			Help:      "Whether the last config reload succeeded (1) or was rejected (0)",
+		},
+		[]string{},
+	)
 )
 
+func init() {
+	prometheus.MustRegister(metricConfigReloadsTotal)
+	prometheus.MustRegister(metricConfigLastReloadSuccess)
+}
+
 // Cerberus implements github.com/sylr/go-libqd/config.Config
 type Cerberus struct {
 	Reloads          int64            `yaml:"-"`
 	Version          bool             `                                                       long:"version"`
 	File             string           `                                             short:"f" long:"config"`
+	Strict           bool             `yaml:"strict" json:"strict" toml:"strict" long:"strict"`
 	Verbose          []bool           `yaml:"verbose" json:"verbose" toml:"verbose" short:"v" long:"verbose"`
+	Log              Log              `yaml:"log" json:"log" toml:"log"`
 	ListeningAddress string           `yaml:"address" json:"address" toml:"address" short:"a" long:"address"`
-	Slack            Slack            `yaml:"slack"`
+	AdminAddress     string           `yaml:"admin_address" json:"admin_address" toml:"admin_address" long:"admin-address"`
+	TLS              *TLS             `yaml:"tls" json:"tls" toml:"tls"`
+	Admin            *Admin           `yaml:"admin" json:"admin" toml:"admin"`
+	Slack            Slack            `yaml:"slack" json:"slack" toml:"slack"`
+	Workers          Workers          `yaml:"workers" json:"workers" toml:"workers"`
+	State            State            `yaml:"state" json:"state" toml:"state"`
+	Health           Health           `yaml:"health" json:"health" toml:"health"`
+	EventRecorder    *EventRecorder   `yaml:"event_recorder" json:"event_recorder" toml:"event_recorder"`
+	Tracing          *Tracing         `yaml:"tracing" json:"tracing" toml:"tracing"`
+	Audit            *Audit           `yaml:"audit" json:"audit" toml:"audit"`
+	Report           *Report          `yaml:"report" json:"report" toml:"report"`
+	Scheduler        *Scheduler       `yaml:"scheduler" json:"scheduler" toml:"scheduler"`
+	Throttle         *Throttle        `yaml:"throttle" json:"throttle" toml:"throttle"`
+	ShutdownGrace    time.Duration    `yaml:"shutdown_grace_period" json:"shutdown_grace_period" toml:"shutdown_grace_period" long:"shutdown-grace-period"`
+	ShutdownDelay    time.Duration    `yaml:"shutdown_delay" json:"shutdown_delay" toml:"shutdown_delay" long:"shutdown-delay"`
 	CerberusMention  *CerberusMention `yaml:"cerberus_mention" json:"cerberus_mention" toml:"cerberus_mention"`
+	Welcome          *Welcome         `yaml:"welcome" json:"welcome" toml:"welcome"`
+	ChannelNaming    *ChannelNaming   `yaml:"channel_naming" json:"channel_naming" toml:"channel_naming"`
+	TeamUserGroups   *TeamUserGroups  `yaml:"team_usergroups" json:"team_usergroups" toml:"team_usergroups"`
+	UserGroups       *UserGroups      `yaml:"usergroups" json:"usergroups" toml:"usergroups"`
+	Membership       *Membership      `yaml:"membership" json:"membership" toml:"membership"`
 }
 
 // ConfigFile ...
@@ -41,27 +94,567 @@ func (c *Cerberus) ConfigFile() string {
 	return c.File
 }
 
+// Log configures the log format, "text" or "json", and the log output,
+// "stdout", "stderr" or a file path.
+type Log struct {
+	Format string `yaml:"format" json:"format" toml:"format" long:"log-format"`
+	Output string `yaml:"output" json:"output" toml:"output" long:"log-output"`
+}
+
+// TLS configures the listeners TLS. Certificates are reloaded from disk
+// whenever they change.
+type TLS struct {
+	CertFile     string `yaml:"cert_file" json:"cert_file" toml:"cert_file"`
+	KeyFile      string `yaml:"key_file" json:"key_file" toml:"key_file"`
+	MinVersion   string `yaml:"min_version" json:"min_version" toml:"min_version"`
+	ClientCAFile string `yaml:"client_ca_file" json:"client_ca_file" toml:"client_ca_file"`
+	ClientAuth   string `yaml:"client_auth" json:"client_auth" toml:"client_auth"`
+}
+
+// ParseTLSVersion returns the tls version matching "1.0", "1.1", "1.2" or
+// "1.3". An empty version defaults to TLS 1.2.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version `%s`", version)
+	}
+}
+
+// ParseTLSClientAuth returns the tls.ClientAuthType matching clientAuth. An
+// empty clientAuth defaults to "none".
+func ParseTLSClientAuth(clientAuth string) (tls.ClientAuthType, error) {
+	switch clientAuth {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require":
+		return tls.RequireAnyClientCert, nil
+	case "verify_if_given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require_and_verify":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS client auth `%s`", clientAuth)
+	}
+}
+
+// LoadCertPool returns a *x509.CertPool containing the PEM certificates of file.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("loading client CAs: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("loading client CAs: no certificate found in %s", file)
+	}
+
+	return pool, nil
+}
+
+// Admin holds the protection of the admin route groups. Admin routes are served
+// by the admin listener if AdminAddress is set, by the main listener otherwise.
+// The main listener being public, it only serves profiling if Pprof protects
+// it.
+type Admin struct {
+	Pprof   *HTTPAuth `yaml:"pprof" json:"pprof" toml:"pprof"`
+	Metrics *HTTPAuth `yaml:"metrics" json:"metrics" toml:"metrics"`
+	Audit   *HTTPAuth `yaml:"audit" json:"audit" toml:"audit"`
+}
+
+// HTTPAuth describes how a group of routes is protected. When several
+// credentials are set, any of them is accepted. AllowedNetworks is enforced
+// on top of credentials.
+type HTTPAuth struct {
+	BasicAuth       *BasicAuth `yaml:"basic_auth" json:"basic_auth" toml:"basic_auth"`
+	BearerToken     string     `yaml:"bearer_token" json:"bearer_token" toml:"bearer_token" conform:"redact"`
+	AllowedNetworks []string   `yaml:"allowed_networks" json:"allowed_networks" toml:"allowed_networks"`
+}
+
+// Protected reports whether credentials or networks restrict the access
+func (a *HTTPAuth) Protected() bool {
+	return a != nil && (a.BasicAuth != nil || len(a.BearerToken) > 0 || len(a.AllowedNetworks) > 0)
+}
+
+// BasicAuth ...
+type BasicAuth struct {
+	Username string `yaml:"username" json:"username" toml:"username"`
+	Password string `yaml:"password" json:"password" toml:"password" conform:"redact"`
+}
+
+// ParseNetworks parses a list of CIDRs or IP addresses.
+func ParseNetworks(networks []string) ([]*net.IPNet, error) {
+	var ipnets []*net.IPNet
+
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address `%s`", network)
+			}
+
+			if ip.To4() != nil {
+				network = network + "/32"
+			} else {
+				network = network + "/128"
+			}
+		}
+
+		_, ipnet, err := net.ParseCIDR(network)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ipnets = append(ipnets, ipnet)
+	}
+
+	return ipnets, nil
+}
+
 // Slack ...
 type Slack struct {
-	Token   string `yaml:"token" json:"token" toml:"tokeb" conform:"redact"`
-	Verbose bool   `yaml:"verbose" json:"verbose" toml:"verbose" `
+	Token         string `yaml:"token" json:"token" toml:"token" conform:"redact"`
+	SigningSecret string `yaml:"signing_secret" json:"signing_secret" toml:"signing_secret" conform:"redact"`
+	Verbose       bool   `yaml:"verbose" json:"verbose" toml:"verbose" `
+}
+
+// Workers configures the pool of workers processing Slack events.
+type Workers struct {
+	Count     int `yaml:"count" json:"count" toml:"count"`
+	QueueSize int `yaml:"queue_size" json:"queue_size" toml:"queue_size"`
+}
+
+// State configures the state store. State is only kept in memory if File is
+// not set.
+type State struct {
+	File          string        `yaml:"file" json:"file" toml:"file"`
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval" toml:"flush_interval"`
+}
+
+// Health configures the readiness checks.
+type Health struct {
+	CheckInterval time.Duration `yaml:"check_interval" json:"check_interval" toml:"check_interval"`
+	CheckTimeout  time.Duration `yaml:"check_timeout" json:"check_timeout" toml:"check_timeout"`
+}
+
+// EventRecorder configures the capture of received events to rotating JSONL
+// files in Directory.
+type EventRecorder struct {
+	Directory   string              `yaml:"directory" json:"directory" toml:"directory"`
+	MaxFileSize int64               `yaml:"max_file_size" json:"max_file_size" toml:"max_file_size"`
+	MaxFiles    int                 `yaml:"max_files" json:"max_files" toml:"max_files"`
+	SampleRate  float64             `yaml:"sample_rate" json:"sample_rate" toml:"sample_rate"`
+	EventTypes  []string            `yaml:"event_types" json:"event_types" toml:"event_types"`
+	Redact      EventRecorderRedact `yaml:"redact" json:"redact" toml:"redact"`
+}
+
+// EventRecorderRedact selects the event fields redacted before being recorded.
+type EventRecorderRedact struct {
+	Text  bool `yaml:"text" json:"text" toml:"text"`
+	Users bool `yaml:"users" json:"users" toml:"users"`
+}
+
+// Tracing configures the export of OpenTelemetry traces. Exporter is "otlp",
+// which sends spans over OTLP/HTTP to Endpoint, or "stdout".
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" json:"exporter" toml:"exporter"`
+	Endpoint    string  `yaml:"endpoint" json:"endpoint" toml:"endpoint"`
+	Insecure    bool    `yaml:"insecure" json:"insecure" toml:"insecure"`
+	ServiceName string  `yaml:"service_name" json:"service_name" toml:"service_name"`
+	SampleRate  float64 `yaml:"sample_rate" json:"sample_rate" toml:"sample_rate"`
+}
+
+// Audit configures the audit log of enforcement decisions. Entries are appended
+// to daily files in Directory which are deleted once older than Retention.
+// Entries carry EffectivePolicyVersion: PolicyVersion, or else a hash of the
+// config file.
+type Audit struct {
+	Directory              string        `yaml:"directory" json:"directory" toml:"directory"`
+	Retention              time.Duration `yaml:"retention" json:"retention" toml:"retention"`
+	PolicyVersion          string        `yaml:"policy_version" json:"policy_version" toml:"policy_version"`
+	EffectivePolicyVersion string        `yaml:"-" json:"-" toml:"-"`
+}
+
+// Report configures the weekly policy report posted to Channel according to
+// the cron expression Schedule. It is built from the audit log.
+type Report struct {
+	Channel      string `yaml:"channel" json:"channel" toml:"channel"`
+	Schedule     string `yaml:"schedule" json:"schedule" toml:"schedule"`
+	Anonymize    bool   `yaml:"anonymize" json:"anonymize" toml:"anonymize"`
+	TopOffenders int    `yaml:"top_offenders" json:"top_offenders" toml:"top_offenders"`
+}
+
+// Scheduler configures the jobs run according to cron expressions.
+type Scheduler struct {
+	Jobs []Job `yaml:"jobs" json:"jobs" toml:"jobs"`
+}
+
+// Job runs Action according to the cron expression Schedule evaluated in
+// Timezone, UTC by default. If CatchUp is set a run missed while cerberus was
+// down is done at startup.
+type Job struct {
+	Name     string `yaml:"name" json:"name" toml:"name"`
+	Schedule string `yaml:"schedule" json:"schedule" toml:"schedule"`
+	Timezone string `yaml:"timezone" json:"timezone" toml:"timezone"`
+	Action   string `yaml:"action" json:"action" toml:"action"`
+	CatchUp  bool   `yaml:"catch_up" json:"catch_up" toml:"catch_up"`
+}
+
+// TeamUserGroups configures the team_usergroups job checking that every team
+// channel has a matching usergroup. Its findings are posted to Channel if set,
+// and if Create is set the missing usergroups are created with the team
+// channel as default channel.
+type TeamUserGroups struct {
+	Channel string `yaml:"channel" json:"channel" toml:"channel"`
+	Create  bool   `yaml:"create" json:"create" toml:"create"`
+}
+
+// UserGroups declares the usergroups managed by cerberus. Slack is synced to
+// match them whenever the config is loaded and according to the cron
+// expression Schedule, every 15 minutes by default. With DryRun the changes
+// are only logged. Changes of managed usergroups made by hand are reported to
+// AlertChannel if set.
+type UserGroups struct {
+	Schedule     string      `yaml:"schedule" json:"schedule" toml:"schedule"`
+	DryRun       bool        `yaml:"dry_run" json:"dry_run" toml:"dry_run"`
+	AlertChannel string      `yaml:"alert_channel" json:"alert_channel" toml:"alert_channel"`
+	Groups       []UserGroup `yaml:"groups" json:"groups" toml:"groups"`
+}
+
+// UserGroup is a usergroup managed by cerberus. Members are Slack user IDs or
+// emails, added to the members of the team Source of the membership provider,
+// and Channels the IDs of its default channels. Name defaults to the handle,
+// Description and Channels are left untouched if empty.
+type UserGroup struct {
+	Handle      string   `yaml:"handle" json:"handle" toml:"handle"`
+	Name        string   `yaml:"name" json:"name" toml:"name"`
+	Description string   `yaml:"description" json:"description" toml:"description"`
+	Members     []string `yaml:"members" json:"members" toml:"members"`
+	Source      string   `yaml:"source" json:"source" toml:"source"`
+	Channels    []string `yaml:"channels" json:"channels" toml:"channels"`
+}
+
+// Managed returns the declaration of the usergroup handle, nil if it is not
+// managed.
+func (u *UserGroups) Managed(handle string) *UserGroup {
+	for i := range u.Groups {
+		if u.Groups[i].Handle == handle {
+			return &u.Groups[i]
+		}
+	}
+
+	return nil
+}
+
+// Membership selects where team members are looked up: "slack" usergroups,
+// the default, a "directory" export file or an "ldap" server. Directory and
+// LDAP teams are reloaded every Refresh, 10 minutes by default, and their
+// members matched to Slack users by email. The team of a team channel is named
+// after its usergroup handle.
+type Membership struct {
+	Provider  string               `yaml:"provider" json:"provider" toml:"provider"`
+	Refresh   time.Duration        `yaml:"refresh" json:"refresh" toml:"refresh"`
+	Directory *MembershipDirectory `yaml:"directory" json:"directory" toml:"directory"`
+	LDAP      *MembershipLDAP      `yaml:"ldap" json:"ldap" toml:"ldap"`
+}
+
+// MembershipDirectory is a directory export file listing the members of teams.
+// Format is "csv", "json" or "ldif", guessed from the file extension if empty.
+type MembershipDirectory struct {
+	File   string `yaml:"file" json:"file" toml:"file"`
+	Format string `yaml:"format" json:"format" toml:"format"`
+}
+
+// FileFormat returns Format, or the extension of File if empty
+func (d *MembershipDirectory) FileFormat() string {
+	if len(d.Format) > 0 {
+		return d.Format
+	}
+
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(d.File)), ".")
+}
+
+// MembershipLDAP is an LDAP server whose groups matching GroupFilter are the
+// teams, named after GroupAttribute and listing the DNs of their members in
+// MemberAttribute. The emails of members are read from MailAttribute.
+type MembershipLDAP struct {
+	URL             string `yaml:"url" json:"url" toml:"url"`
+	BindDN          string `yaml:"bind_dn" json:"bind_dn" toml:"bind_dn"`
+	BindPassword    string `yaml:"bind_password" json:"bind_password" toml:"bind_password" conform:"redact"`
+	BaseDN          string `yaml:"base_dn" json:"base_dn" toml:"base_dn"`
+	GroupFilter     string `yaml:"group_filter" json:"group_filter" toml:"group_filter"`
+	GroupAttribute  string `yaml:"group_attribute" json:"group_attribute" toml:"group_attribute"`
+	MemberAttribute string `yaml:"member_attribute" json:"member_attribute" toml:"member_attribute"`
+	MailAttribute   string `yaml:"mail_attribute" json:"mail_attribute" toml:"mail_attribute"`
+}
+
+// Throttle limits the replies and messages sent by actions. An action is
+// throttled as soon as one of the rules applying to it is exceeded.
+type Throttle struct {
+	Rules []ThrottleRule `yaml:"rules" json:"rules" toml:"rules"`
+}
+
+// ThrottleRule allows Limit runs per Window of Actions, all of them if empty,
+// for each user, each channel or globally depending on Scope. OnLimit is what
+// is done instead once the limit is hit: "silence", "react" to the triggering
+// message with Emoji, or "reply" Message once per window.
+type ThrottleRule struct {
+	Scope   string        `yaml:"scope" json:"scope" toml:"scope"`
+	Actions []string      `yaml:"actions" json:"actions" toml:"actions"`
+	Limit   int           `yaml:"limit" json:"limit" toml:"limit"`
+	Window  time.Duration `yaml:"window" json:"window" toml:"window"`
+	OnLimit string        `yaml:"on_limit" json:"on_limit" toml:"on_limit"`
+	Emoji   string        `yaml:"emoji" json:"emoji" toml:"emoji"`
+	Message string        `yaml:"message" json:"message" toml:"message"`
+}
+
+// AppliesTo reports whether the rule limits action
+func (r ThrottleRule) AppliesTo(action string) bool {
+	if len(r.Actions) == 0 {
+		return true
+	}
+
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Spec returns the cron spec of the job, prefixed by its timezone
+func (j Job) Spec() string {
+	if len(j.Timezone) == 0 {
+		return "CRON_TZ=UTC " + j.Schedule
+	}
+
+	return "CRON_TZ=" + j.Timezone + " " + j.Schedule
+}
+
+var (
+	// jobActions are the actions which can be run as jobs
+	jobActions = make(map[string]bool)
+)
+
+// RegisterJobAction declares an action which can be run by a job
+func RegisterJobAction(action string) {
+	jobActions[action] = true
+}
+
+// JobActions returns the sorted actions which can be run by a job
+func JobActions() []string {
+	actions := make([]string, 0, len(jobActions))
+
+	for action := range jobActions {
+		actions = append(actions, action)
+	}
+
+	sort.Strings(actions)
+
+	return actions
+}
+
+// DefaultWelcomeTemplate is the default template of welcome messages
+const DefaultWelcomeTemplate = `Welcome to <#{{ .Channel }}> <@{{ .User }}> :wave:
+{{ if .Purpose }}*Purpose:* {{ .Purpose }}
+{{ end }}{{ if .UserGroupID }}To get the team's attention, mention <!subteam^{{ .UserGroupID }}>.
+{{ end }}{{ if .Pins }}*Pinned links:*
+{{ range .Pins }}• {{ . }}
+{{ end }}{{ end }}{{ .Etiquette }}`
+
+// Welcome configures the direct message sent to the members joining channels
+// whose name matches one of the Channels patterns, "team-*" by default.
+// Template is a text/template rendered with the channel's purpose, usergroup,
+// pinned links and etiquette. If JoinButton is set, newcomers who are not in
+// the team's usergroup are offered to request joining it, the request being
+// posted in the channel for the usergroup's owners, its creator and the
+// workspace admins, to approve. Usergroups managed under UserGroups get no
+// button since their members are declared. JoinButton requires the Slack
+// signing secret.
+type Welcome struct {
+	Channels   []string `yaml:"channels" json:"channels" toml:"channels"`
+	Template   string   `yaml:"template" json:"template" toml:"template"`
+	JoinButton bool     `yaml:"join_button" json:"join_button" toml:"join_button"`
+}
+
+// ChannelNaming configures the naming policy checked when channels are created
+// or renamed. Names must match one of the Patterns, if any, and only workspace
+// admins may use the ReservedPrefixes. The channel creator is sent suggestions
+// on violations, which are also reported to AdminChannel if set. If Rename is
+// set, channels are renamed to the first suggestion using AdminToken.
+type ChannelNaming struct {
+	Patterns         []string `yaml:"patterns" json:"patterns" toml:"patterns"`
+	ReservedPrefixes []string `yaml:"reserved_prefixes" json:"reserved_prefixes" toml:"reserved_prefixes"`
+	AdminChannel     string   `yaml:"admin_channel" json:"admin_channel" toml:"admin_channel"`
+	Rename           bool     `yaml:"rename" json:"rename" toml:"rename"`
+	AdminToken       string   `yaml:"admin_token" json:"admin_token" toml:"admin_token" conform:"redact"`
 }
 
 // CerberusMention ...
 type CerberusMention struct {
-	Messages []CerberusMentionMessage `yaml:"messages" json:"messages" toml:"messages"`
+	Selection string                   `yaml:"selection" json:"selection" toml:"selection"`
+	Messages  []CerberusMentionMessage `yaml:"messages" json:"messages" toml:"messages"`
 }
 
-// CerberusMentionMessage ...
+// MessageDateLayout is the layout of the date range of messages
+const MessageDateLayout = "01-02"
+
+// MaxImageFileSize is the maximum size of the images uploaded as replies
+const MaxImageFileSize = 5 << 20
+
+// imageFileTypes are the content types of the images uploaded as replies
+var imageFileTypes = []string{"image/gif", "image/jpeg", "image/png"}
+
+// CerberusMentionMessage is a reply to mentions. It is picked with a
+// probability proportional to Weight among the messages whose filters match
+// the mention: Channels and Users IDs, the From/To "MM-DD" date range and
+// Keywords. Messages with matching keywords take precedence over the others.
+// ImageFile is a local image uploaded to Slack once and reused, as opposed to
+// ImageURL which must be publicly reachable.
 type CerberusMentionMessage struct {
-	Text     string `yaml:"text" json:"text" toml:"text"`
-	ImageURL string `yaml:"image_url" json:"image_url" toml:"image_url"`
+	Text      string   `yaml:"text" json:"text" toml:"text"`
+	ImageURL  string   `yaml:"image_url" json:"image_url" toml:"image_url"`
+	ImageFile string   `yaml:"image_file" json:"image_file" toml:"image_file"`
+	Weight    int      `yaml:"weight" json:"weight" toml:"weight"`
+	Channels  []string `yaml:"channels" json:"channels" toml:"channels"`
+	Users     []string `yaml:"users" json:"users" toml:"users"`
+	From      string   `yaml:"from" json:"from" toml:"from"`
+	To        string   `yaml:"to" json:"to" toml:"to"`
+	Keywords  []string `yaml:"keywords" json:"keywords" toml:"keywords"`
 }
 
 // Safe is a struct Validators and Appliers.
 type Safe struct {
-	Logger *log.Logger
-	mu     sync.Mutex
+	Logger     *log.Logger
+	lastGood   *Cerberus
+	logFile    *os.File
+	mu         sync.Mutex
+	rollbackMu sync.Mutex
+}
+
+// Validators returns a validator running all validators and recording the
+// reload as failed if any of them returns an error.
+func (s *Safe) Validators(validators ...qdconfig.Validator) qdconfig.Validator {
+	return func(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+		var errs []error
+
+		for _, validator := range validators {
+			errs = append(errs, validator(currentConfig, newConfig)...)
+		}
+
+		if len(errs) > 0 {
+			metricConfigLastReloadSuccess.WithLabelValues().Set(0)
+		}
+
+		return errs
+	}
+}
+
+// Appliers returns an applier running appliers in order. If one of them fails,
+// the appliers are run again to go back to the last known good config which is
+// then copied into newConfig so that it remains the current config.
+func (s *Safe) Appliers(appliers ...qdconfig.Applier) qdconfig.Applier {
+	return func(currentConfig qdconfig.Config, newConfig qdconfig.Config) error {
+		s.rollbackMu.Lock()
+		defer s.rollbackMu.Unlock()
+
+		newConf := newConfig.(*Cerberus)
+
+		for _, applier := range appliers {
+			err := applier(currentConfig, newConfig)
+
+			if err == nil {
+				continue
+			}
+
+			metricConfigLastReloadSuccess.WithLabelValues().Set(0)
+
+			if s.lastGood == nil {
+				return err
+			}
+
+			s.Logger.Errorf("Applying new config failed, rolling back to last known good config: %v", err)
+			lastGood := s.lastGood.DeepCopy()
+
+			for _, applier := range appliers {
+				if rerr := applier(newConfig, lastGood); rerr != nil {
+					s.Logger.Errorf("Rolling back config: %v", rerr)
+				}
+			}
+
+			reloads := newConf.Reloads
+			*newConf = *lastGood
+			newConf.Reloads = reloads
+
+			return err
+		}
+
+		s.lastGood = newConf.DeepCopy()
+		metricConfigLastReloadSuccess.WithLabelValues().Set(1)
+
+		return nil
+	}
+}
+
+// ReloadFailed records that a config which went through the appliers could not
+// be applied by the components, which have been rolled back to lastGood. The
+// reload is reported as failed and lastGood remains the config appliers roll
+// back to.
+func (s *Safe) ReloadFailed(lastGood *Cerberus) {
+	s.rollbackMu.Lock()
+	defer s.rollbackMu.Unlock()
+
+	s.lastGood = lastGood.DeepCopy()
+	metricConfigLastReloadSuccess.WithLabelValues().Set(0)
+}
+
+// DefaultValidators returns the validators run on every config load, in the
+// order they should run.
+func (s *Safe) DefaultValidators() []qdconfig.Validator {
+	return append([]qdconfig.Validator{s.SecretsValidator}, s.ConfigValidators()...)
+}
+
+// ConfigValidators returns the validators which do not need anything else
+// than the config itself, secrets are not resolved.
+func (s *Safe) ConfigValidators() []qdconfig.Validator {
+	return []qdconfig.Validator{
+		s.StrictValidator,
+		s.ListeningAddressValidator,
+		s.AdminAddressValidator,
+		s.TLSValidator,
+		s.AdminValidator,
+		s.WorkersValidator,
+		s.StateValidator,
+		s.HealthValidator,
+		s.ShutdownValidator,
+		s.EventRecorderValidator,
+		s.TracingValidator,
+		s.AuditValidator,
+		s.ReportValidator,
+		s.SchedulerValidator,
+		s.UserGroupsValidator,
+		s.MembershipValidator,
+		s.ThrottleValidator,
+		s.CerberusMentionValidator,
+		s.WelcomeValidator,
+		s.ChannelNamingValidator,
+		s.LogValidator,
+	}
 }
 
 // ListeningAddressValidator defaults the listening address to "0.0.0.0:8080" if not set.
@@ -73,38 +666,814 @@ func (s *Safe) ListeningAddressValidator(currentConfig qdconfig.Config, newConfi
 		newConf.ListeningAddress = "0.0.0.0:8080"
 	}
 
+	if _, _, err := net.SplitHostPort(newConf.ListeningAddress); err != nil {
+		errors = append(errors, pathErrorf("address", "%w", err))
+	}
+
+	return errors
+}
+
+// AdminAddressValidator checks that the admin listening address is valid and
+// differs from the listening address.
+func (s *Safe) AdminAddressValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if len(newConf.AdminAddress) == 0 {
+		return nil
+	}
+
+	if newConf.AdminAddress == newConf.ListeningAddress {
+		errors = append(errors, pathErrorf("admin_address", "must differ from listening address"))
+	}
+
+	if _, _, err := net.SplitHostPort(newConf.AdminAddress); err != nil {
+		errors = append(errors, pathErrorf("admin_address", "%w", err))
+	}
+
+	return errors
+}
+
+// TLSValidator checks that the certificate and client CAs can be loaded.
+func (s *Safe) TLSValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.TLS == nil {
+		return nil
+	}
+
+	if _, err := tls.LoadX509KeyPair(newConf.TLS.CertFile, newConf.TLS.KeyFile); err != nil {
+		errors = append(errors, pathErrorf("tls", "%w", err))
+	}
+
+	if _, err := ParseTLSVersion(newConf.TLS.MinVersion); err != nil {
+		errors = append(errors, pathErrorf("tls.min_version", "%w", err))
+	}
+
+	clientAuth, err := ParseTLSClientAuth(newConf.TLS.ClientAuth)
+
+	if err != nil {
+		errors = append(errors, pathErrorf("tls.client_auth", "%w", err))
+	}
+
+	if len(newConf.TLS.ClientCAFile) > 0 {
+		if _, err := LoadCertPool(newConf.TLS.ClientCAFile); err != nil {
+			errors = append(errors, pathErrorf("tls.client_ca_file", "%w", err))
+		}
+	} else if clientAuth >= tls.VerifyClientCertIfGiven {
+		errors = append(errors, pathErrorf("tls.client_auth", "`%s` requires tls.client_ca_file", newConf.TLS.ClientAuth))
+	}
+
+	return errors
+}
+
+// AdminValidator checks the admin route groups protection.
+func (s *Safe) AdminValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Admin == nil {
+		return nil
+	}
+
+	groups := map[string]*HTTPAuth{
+		"pprof":   newConf.Admin.Pprof,
+		"metrics": newConf.Admin.Metrics,
+		"audit":   newConf.Admin.Audit,
+	}
+
+	for name, auth := range groups {
+		if auth == nil {
+			continue
+		}
+
+		if _, err := ParseNetworks(auth.AllowedNetworks); err != nil {
+			errors = append(errors, pathErrorf("admin."+name+".allowed_networks", "%w", err))
+		}
+
+		if auth.BasicAuth != nil && (len(auth.BasicAuth.Username) == 0 || len(auth.BasicAuth.Password) == 0) {
+			errors = append(errors, pathErrorf("admin."+name+".basic_auth", "username and password must be set"))
+		}
+	}
+
+	return errors
+}
+
+// WorkersValidator defaults the workers count to 4 and the queue size to 100.
+func (s *Safe) WorkersValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Workers.Count <= 0 {
+		newConf.Workers.Count = 4
+	}
+
+	if newConf.Workers.QueueSize <= 0 {
+		newConf.Workers.QueueSize = 100
+	}
+
 	if currentConfig != nil {
 		curConf := currentConfig.(*Cerberus)
 
-		if curConf.ListeningAddress != newConf.ListeningAddress {
-			errors = append(errors, fmt.Errorf("Changing listening address is not implemented"))
+		if curConf.Workers != newConf.Workers {
+			errors = append(errors, pathErrorf("workers", "Changing workers is not implemented"))
 		}
 	}
 
 	return errors
 }
 
-// LogValidator does nothing
-func (s *Safe) LogValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+// StateValidator defaults the state flush interval to 10s.
+func (s *Safe) StateValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.State.FlushInterval <= 0 {
+		newConf.State.FlushInterval = 10 * time.Second
+	}
+
+	if currentConfig != nil {
+		curConf := currentConfig.(*Cerberus)
+
+		if curConf.State != newConf.State {
+			errors = append(errors, pathErrorf("state", "Changing state store is not implemented"))
+		}
+	}
+
+	return errors
+}
+
+// HealthValidator defaults the readiness checks interval to 30s and their
+// timeout to 10s.
+func (s *Safe) HealthValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Health.CheckInterval <= 0 {
+		newConf.Health.CheckInterval = 30 * time.Second
+	}
+
+	if newConf.Health.CheckTimeout <= 0 {
+		newConf.Health.CheckTimeout = 10 * time.Second
+	}
+
 	return nil
 }
 
-// LogApplier sets the log level
-func (s *Safe) LogApplier(currentConfig qdconfig.Config, newConfig qdconfig.Config) error {
-	conf := newConfig.(*Cerberus)
+// ShutdownValidator defaults the shutdown grace period to 30s and the delay
+// between the readiness flip and the listener close to 5s, so that probes see
+// the process going not ready. The delay is part of the grace period.
+func (s *Safe) ShutdownValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
 
-	switch {
-	case len(conf.Verbose) == 1:
-		log.SetLevel(log.DebugLevel)
-		log.SetReportCaller(true)
-	case len(conf.Verbose) > 1:
-		log.SetLevel(log.TraceLevel)
-		log.SetReportCaller(true)
-	default:
-		log.SetLevel(log.InfoLevel)
-		log.SetReportCaller(false)
+	if newConf.ShutdownGrace <= 0 {
+		newConf.ShutdownGrace = 30 * time.Second
+	}
+
+	if newConf.ShutdownDelay <= 0 {
+		newConf.ShutdownDelay = 5 * time.Second
+	}
+
+	if newConf.ShutdownDelay >= newConf.ShutdownGrace {
+		errors = append(errors, pathErrorf("shutdown_delay", "must be shorter than shutdown_grace_period"))
 	}
 
+	return errors
+}
+
+// EventRecorderValidator defaults the max file size to 100MiB, the max number
+// of files to 10 and the sample rate to 1.
+func (s *Safe) EventRecorderValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.EventRecorder == nil {
+		return nil
+	}
+
+	if len(newConf.EventRecorder.Directory) == 0 {
+		errors = append(errors, pathErrorf("event_recorder.directory", "must be set"))
+	}
+
+	if newConf.EventRecorder.MaxFileSize <= 0 {
+		newConf.EventRecorder.MaxFileSize = 100 * 1024 * 1024
+	}
+
+	if newConf.EventRecorder.MaxFiles <= 0 {
+		newConf.EventRecorder.MaxFiles = 10
+	}
+
+	if newConf.EventRecorder.SampleRate == 0 {
+		newConf.EventRecorder.SampleRate = 1
+	}
+
+	if newConf.EventRecorder.SampleRate < 0 || newConf.EventRecorder.SampleRate > 1 {
+		errors = append(errors, pathErrorf("event_recorder.sample_rate", "must be between 0 and 1"))
+	}
+
+	return errors
+}
+
+// WelcomeValidator defaults the channel patterns to "team-*" and the template
+// to DefaultWelcomeTemplate.
+func (s *Safe) WelcomeValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Welcome == nil {
+		return nil
+	}
+
+	if len(newConf.Welcome.Channels) == 0 {
+		newConf.Welcome.Channels = []string{"team-*"}
+	}
+
+	for i, pattern := range newConf.Welcome.Channels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errors = append(errors, pathErrorf(fmt.Sprintf("welcome.channels[%d]", i), "`%s`: %w", pattern, err))
+		}
+	}
+
+	if len(newConf.Welcome.Template) == 0 {
+		newConf.Welcome.Template = DefaultWelcomeTemplate
+	}
+
+	if _, err := template.New("welcome").Parse(newConf.Welcome.Template); err != nil {
+		errors = append(errors, pathErrorf("welcome.template", "%w", err))
+	}
+
+	// Interactions can only be trusted if their signature is checked
+	if newConf.Welcome.JoinButton && len(newConf.Slack.SigningSecret) == 0 {
+		errors = append(errors, pathErrorf("welcome.join_button", "requires slack.signing_secret to be set"))
+	}
+
+	return errors
+}
+
+// ChannelNamingValidator checks the patterns and that an admin token is set if
+// channels are renamed.
+func (s *Safe) ChannelNamingValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.ChannelNaming == nil {
+		return nil
+	}
+
+	for i, pattern := range newConf.ChannelNaming.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errors = append(errors, pathErrorf(fmt.Sprintf("channel_naming.patterns[%d]", i), "`%s`: %w", pattern, err))
+		}
+	}
+
+	for i, prefix := range newConf.ChannelNaming.ReservedPrefixes {
+		if len(prefix) == 0 {
+			errors = append(errors, pathErrorf(fmt.Sprintf("channel_naming.reserved_prefixes[%d]", i), "must not be empty"))
+		}
+	}
+
+	if newConf.ChannelNaming.Rename && len(newConf.ChannelNaming.AdminToken) == 0 {
+		errors = append(errors, pathErrorf("channel_naming.admin_token", "must be set to rename channels"))
+	}
+
+	return errors
+}
+
+// CerberusMentionValidator defaults the selection to "random" and the weight
+// of messages to 1, and checks that every message has a text or a well formed
+// image URL and a valid date range.
+func (s *Safe) CerberusMentionValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.CerberusMention == nil {
+		return nil
+	}
+
+	switch newConf.CerberusMention.Selection {
+	case "":
+		newConf.CerberusMention.Selection = "random"
+	case "random", "non_repeating":
+	default:
+		errors = append(errors, pathErrorf("cerberus_mention.selection", "unknown selection `%s`", newConf.CerberusMention.Selection))
+	}
+
+	for i := range newConf.CerberusMention.Messages {
+		message := &newConf.CerberusMention.Messages[i]
+		path := fmt.Sprintf("cerberus_mention.messages[%d]", i)
+
+		if message.Weight == 0 {
+			message.Weight = 1
+		}
+
+		if message.Weight < 0 {
+			errors = append(errors, pathErrorf(path+".weight", "must be positive"))
+		}
+
+		if (len(message.From) == 0) != (len(message.To) == 0) {
+			errors = append(errors, pathErrorf(path, "from and to must be set together"))
+		}
+
+		if _, err := time.Parse(MessageDateLayout, message.From); len(message.From) > 0 && err != nil {
+			errors = append(errors, pathErrorf(path+".from", "`%s` is not a MM-DD date", message.From))
+		}
+
+		if _, err := time.Parse(MessageDateLayout, message.To); len(message.To) > 0 && err != nil {
+			errors = append(errors, pathErrorf(path+".to", "`%s` is not a MM-DD date", message.To))
+		}
+
+		if len(message.Text) == 0 && len(message.ImageURL) == 0 && len(message.ImageFile) == 0 {
+			errors = append(errors, pathErrorf(path, "text, image_url or image_file must be set"))
+		}
+
+		if len(message.ImageURL) > 0 && len(message.ImageFile) > 0 {
+			errors = append(errors, pathErrorf(path, "image_url and image_file are mutually exclusive"))
+		}
+
+		if len(message.ImageFile) > 0 {
+			if err := validateImageFile(message.ImageFile); err != nil {
+				errors = append(errors, pathErrorf(path+".image_file", "%w", err))
+			}
+		}
+
+		if len(message.ImageURL) > 0 {
+			u, err := url.ParseRequestURI(message.ImageURL)
+
+			if err != nil {
+				errors = append(errors, pathErrorf(path+".image_url", "%w", err))
+			} else if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+				errors = append(errors, pathErrorf(path+".image_url", "`%s` is not an http(s) URL", message.ImageURL))
+			}
+		}
+	}
+
+	return errors
+}
+
+// UserGroupsValidator defaults the schedule to every 15 minutes and the name of
+// usergroups to their handle.
+func (s *Safe) UserGroupsValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.UserGroups == nil {
+		return nil
+	}
+
+	if len(newConf.UserGroups.Schedule) == 0 {
+		newConf.UserGroups.Schedule = "*/15 * * * *"
+	}
+
+	if _, err := cron.ParseStandard(newConf.UserGroups.Schedule); err != nil {
+		errors = append(errors, pathErrorf("usergroups.schedule", "%w", err))
+	}
+
+	handles := make(map[string]bool)
+
+	for i := range newConf.UserGroups.Groups {
+		group := &newConf.UserGroups.Groups[i]
+		path := fmt.Sprintf("usergroups.groups[%d]", i)
+
+		switch {
+		case len(group.Handle) == 0:
+			errors = append(errors, pathErrorf(path+".handle", "must be set"))
+		case strings.ContainsAny(group.Handle, "@ \t"):
+			errors = append(errors, pathErrorf(path+".handle", "`%s` must not contain @ or spaces", group.Handle))
+		case handles[group.Handle]:
+			errors = append(errors, pathErrorf(path+".handle", "duplicate usergroup `%s`", group.Handle))
+		}
+
+		handles[group.Handle] = true
+
+		if len(group.Name) == 0 {
+			group.Name = group.Handle
+		}
+
+		if len(group.Members) == 0 && len(group.Source) == 0 {
+			errors = append(errors, pathErrorf(path+".members", "must not be empty without source"))
+		}
+
+		for j, member := range group.Members {
+			if len(member) == 0 {
+				errors = append(errors, pathErrorf(fmt.Sprintf("%s.members[%d]", path, j), "must not be empty"))
+			}
+		}
+	}
+
+	return errors
+}
+
+// MembershipValidator defaults the provider to slack and the refresh interval
+// to 10 minutes, as well as the LDAP attributes to the groupOfNames ones.
+func (s *Safe) MembershipValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Membership == nil {
+		return nil
+	}
+
+	membership := newConf.Membership
+
+	if len(membership.Provider) == 0 {
+		membership.Provider = "slack"
+	}
+
+	if membership.Refresh <= 0 {
+		membership.Refresh = 10 * time.Minute
+	}
+
+	switch membership.Provider {
+	case "slack":
+	case "directory":
+		if membership.Directory == nil || len(membership.Directory.File) == 0 {
+			errors = append(errors, pathErrorf("membership.directory.file", "must be set"))
+			break
+		}
+
+		// The format is not defaulted as it must follow later file changes
+		switch format := membership.Directory.FileFormat(); format {
+		case "csv", "json", "ldif":
+		default:
+			errors = append(errors, pathErrorf("membership.directory.format", "`%s` must be one of csv, json or ldif", format))
+		}
+	case "ldap":
+		if membership.LDAP == nil || len(membership.LDAP.URL) == 0 {
+			errors = append(errors, pathErrorf("membership.ldap.url", "must be set"))
+			break
+		}
+
+		if len(membership.LDAP.BaseDN) == 0 {
+			errors = append(errors, pathErrorf("membership.ldap.base_dn", "must be set"))
+		}
+
+		if len(membership.LDAP.GroupFilter) == 0 {
+			membership.LDAP.GroupFilter = "(objectClass=groupOfNames)"
+		}
+
+		if len(membership.LDAP.GroupAttribute) == 0 {
+			membership.LDAP.GroupAttribute = "cn"
+		}
+
+		if len(membership.LDAP.MemberAttribute) == 0 {
+			membership.LDAP.MemberAttribute = "member"
+		}
+
+		if len(membership.LDAP.MailAttribute) == 0 {
+			membership.LDAP.MailAttribute = "mail"
+		}
+	default:
+		errors = append(errors, pathErrorf("membership.provider", "`%s` must be one of slack, directory or ldap", membership.Provider))
+	}
+
+	return errors
+}
+
+// ThrottleValidator defaults the action taken when a limit is hit to
+// "silence", the emoji to "hourglass_flowing_sand" and the reply to a request
+// to slow down.
+func (s *Safe) ThrottleValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Throttle == nil {
+		return nil
+	}
+
+	for i := range newConf.Throttle.Rules {
+		rule := &newConf.Throttle.Rules[i]
+		path := fmt.Sprintf("throttle.rules[%d]", i)
+
+		switch rule.Scope {
+		case "user", "channel", "global":
+		case "":
+			errors = append(errors, pathErrorf(path+".scope", "must be set"))
+		default:
+			errors = append(errors, pathErrorf(path+".scope", "unknown scope `%s`", rule.Scope))
+		}
+
+		if rule.Limit <= 0 {
+			errors = append(errors, pathErrorf(path+".limit", "must be positive"))
+		}
+
+		if rule.Window <= 0 {
+			errors = append(errors, pathErrorf(path+".window", "must be positive"))
+		}
+
+		switch rule.OnLimit {
+		case "":
+			rule.OnLimit = "silence"
+		case "silence", "react", "reply":
+		default:
+			errors = append(errors, pathErrorf(path+".on_limit", "unknown action `%s`", rule.OnLimit))
+		}
+
+		rule.Emoji = strings.Trim(rule.Emoji, ":")
+
+		if len(rule.Emoji) == 0 {
+			rule.Emoji = "hourglass_flowing_sand"
+		}
+
+		if len(rule.Message) == 0 {
+			rule.Message = "Slow down please, I will not answer for a little while."
+		}
+	}
+
+	return errors
+}
+
+// validateImageFile checks that file is a gif, jpeg or png image no larger than
+// MaxImageFileSize.
+func validateImageFile(file string) error {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("`%s` is not a regular file", file)
+	}
+
+	if info.Size() > MaxImageFileSize {
+		return fmt.Errorf("`%s` is larger than %d bytes", file, MaxImageFileSize)
+	}
+
+	// DetectContentType considers at most the first 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+
+	contentType := http.DetectContentType(head[:n])
+
+	for _, t := range imageFileTypes {
+		if contentType == t {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("`%s` is %s, expected one of %s", file, contentType, strings.Join(imageFileTypes, ", "))
+}
+
+// TracingValidator defaults the exporter to "otlp", the OTLP endpoint to
+// "localhost:4318", the service name to "cerberus" and the sample rate to 1.
+func (s *Safe) TracingValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Tracing == nil {
+		return nil
+	}
+
+	switch newConf.Tracing.Exporter {
+	case "":
+		newConf.Tracing.Exporter = "otlp"
+	case "otlp", "stdout":
+	default:
+		errors = append(errors, pathErrorf("tracing.exporter", "unknown exporter `%s`", newConf.Tracing.Exporter))
+	}
+
+	if newConf.Tracing.Exporter == "otlp" {
+		if len(newConf.Tracing.Endpoint) == 0 {
+			newConf.Tracing.Endpoint = "localhost:4318"
+		}
+
+		if _, _, err := net.SplitHostPort(newConf.Tracing.Endpoint); err != nil {
+			errors = append(errors, pathErrorf("tracing.endpoint", "%w", err))
+		}
+	}
+
+	if len(newConf.Tracing.ServiceName) == 0 {
+		newConf.Tracing.ServiceName = "cerberus"
+	}
+
+	if newConf.Tracing.SampleRate == 0 {
+		newConf.Tracing.SampleRate = 1
+	}
+
+	if newConf.Tracing.SampleRate < 0 || newConf.Tracing.SampleRate > 1 {
+		errors = append(errors, pathErrorf("tracing.sample_rate", "must be between 0 and 1"))
+	}
+
+	return errors
+}
+
+// AuditValidator defaults the retention to 365 days and the effective policy
+// version to the first 12 characters of the config file sha256.
+func (s *Safe) AuditValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Audit == nil {
+		return nil
+	}
+
+	if len(newConf.Audit.Directory) == 0 {
+		errors = append(errors, pathErrorf("audit.directory", "must be set"))
+	}
+
+	if newConf.Audit.Retention == 0 {
+		newConf.Audit.Retention = 365 * 24 * time.Hour
+	}
+
+	if newConf.Audit.Retention < 24*time.Hour {
+		errors = append(errors, pathErrorf("audit.retention", "must be at least 24h"))
+	}
+
+	// The audit API would otherwise be public on the listener Slack calls
+	if len(newConf.AdminAddress) == 0 && (newConf.Admin == nil || !newConf.Admin.Audit.Protected()) {
+		errors = append(errors, pathErrorf("audit", "requires admin_address or admin.audit authentication"))
+	}
+
+	// Computed on every load as reloads unmarshal onto a copy of the current
+	// config
+	newConf.Audit.EffectivePolicyVersion = newConf.Audit.PolicyVersion
+
+	if len(newConf.Audit.PolicyVersion) == 0 && len(newConf.File) > 0 {
+		content, err := ioutil.ReadFile(newConf.File)
+
+		if err != nil {
+			errors = append(errors, pathErrorf("audit.policy_version", "%w", err))
+		} else {
+			sum := sha256.Sum256(content)
+			newConf.Audit.EffectivePolicyVersion = hex.EncodeToString(sum[:])[:12]
+		}
+	}
+
+	return errors
+}
+
+// ReportValidator defaults the schedule to mondays at 9:00 and the number of
+// top offenders to 5.
+func (s *Safe) ReportValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Report == nil {
+		return nil
+	}
+
+	if newConf.Audit == nil {
+		errors = append(errors, pathErrorf("report", "requires audit to be configured"))
+	}
+
+	if len(newConf.Report.Channel) == 0 {
+		errors = append(errors, pathErrorf("report.channel", "must be set"))
+	}
+
+	if len(newConf.Report.Schedule) == 0 {
+		newConf.Report.Schedule = "0 9 * * 1"
+	}
+
+	if _, err := cron.ParseStandard(newConf.Report.Schedule); err != nil {
+		errors = append(errors, pathErrorf("report.schedule", "%w", err))
+	}
+
+	if newConf.Report.TopOffenders == 0 {
+		newConf.Report.TopOffenders = 5
+	}
+
+	if newConf.Report.TopOffenders < 0 {
+		errors = append(errors, pathErrorf("report.top_offenders", "must be positive"))
+	}
+
+	if newConf.Report.TopOffenders > 50 {
+		errors = append(errors, pathErrorf("report.top_offenders", "must be at most 50"))
+	}
+
+	return errors
+}
+
+// SchedulerValidator checks that jobs have a unique name, a valid schedule and
+// timezone and reference an action which can be run as a job.
+func (s *Safe) SchedulerValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	if newConf.Scheduler == nil {
+		return nil
+	}
+
+	// The weekly report and the usergroups sync are scheduled by their sections
+	names := map[string]bool{
+		"weekly_report":   newConf.Report != nil,
+		"usergroups_sync": newConf.UserGroups != nil,
+	}
+
+	for i, job := range newConf.Scheduler.Jobs {
+		path := fmt.Sprintf("scheduler.jobs[%d]", i)
+
+		if len(job.Name) == 0 {
+			errors = append(errors, pathErrorf(path+".name", "must be set"))
+		} else if names[job.Name] {
+			errors = append(errors, pathErrorf(path+".name", "duplicate job `%s`", job.Name))
+		}
+
+		names[job.Name] = true
+
+		if _, err := time.LoadLocation(job.Timezone); err != nil {
+			errors = append(errors, pathErrorf(path+".timezone", "%w", err))
+		} else if _, err := cron.ParseStandard(job.Spec()); err != nil {
+			errors = append(errors, pathErrorf(path+".schedule", "%w", err))
+		}
+
+		if !jobActions[job.Action] {
+			errors = append(errors, pathErrorf(path+".action", "unknown action `%s`, must be one of %s", job.Action, strings.Join(JobActions(), ", ")))
+		}
+	}
+
+	return errors
+}
+
+// LogValidator defaults the log format to "text" and the log output to "stdout".
+func (s *Safe) LogValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	var errors []error
+	newConf := newConfig.(*Cerberus)
+
+	switch newConf.Log.Format {
+	case "":
+		newConf.Log.Format = "text"
+	case "text", "json":
+	default:
+		errors = append(errors, pathErrorf("log.format", "unknown format `%s`", newConf.Log.Format))
+	}
+
+	if len(newConf.Log.Output) == 0 {
+		newConf.Log.Output = "stdout"
+	}
+
+	return errors
+}
+
+// LogApplier sets the log level, format and output
+func (s *Safe) LogApplier(currentConfig qdconfig.Config, newConfig qdconfig.Config) error {
+	conf := newConfig.(*Cerberus)
+
+	switch {
+	case len(conf.Verbose) == 1:
+		log.SetLevel(log.DebugLevel)
+		log.SetReportCaller(true)
+	case len(conf.Verbose) > 1:
+		log.SetLevel(log.TraceLevel)
+		log.SetReportCaller(true)
+	default:
+		log.SetLevel(log.InfoLevel)
+		log.SetReportCaller(false)
+	}
+
+	switch conf.Log.Format {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.SetFormatter(&log.TextFormatter{
+			DisableColors:  true,
+			DisableSorting: false,
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var file *os.File
+
+	switch conf.Log.Output {
+	case "", "stdout":
+		log.SetOutput(os.Stdout)
+	case "stderr":
+		log.SetOutput(os.Stderr)
+	default:
+		if s.logFile != nil && s.logFile.Name() == conf.Log.Output {
+			return nil
+		}
+
+		var err error
+		file, err = os.OpenFile(conf.Log.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+
+		if err != nil {
+			return fmt.Errorf("log.output: %w", err)
+		}
+
+		log.SetOutput(file)
+	}
+
+	if s.logFile != nil {
+		s.logFile.Close()
+	}
+
+	s.logFile = file
+
 	return nil
 }
 
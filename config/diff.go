@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change describes a modified config value.
+type Change struct {
+	Path     string
+	Old      interface{}
+	New      interface{}
+	Redacted bool
+}
+
+// Section returns the top level key of the change path.
+func (c Change) Section() string {
+	return strings.SplitN(strings.SplitN(c.Path, ".", 2)[0], "[", 2)[0]
+}
+
+// String implements fmt.Stringer, redacted values are not printed.
+func (c Change) String() string {
+	if c.Redacted {
+		return fmt.Sprintf("%s: <redacted> -> <redacted>", c.Path)
+	}
+
+	return fmt.Sprintf("%s: %s -> %s", c.Path, formatValue(c.Old), formatValue(c.New))
+}
+
+// Changes is a list of Change.
+type Changes []Change
+
+// Touch reports whether one of the changes belongs to one of sections.
+func (cs Changes) Touch(sections ...string) bool {
+	for _, c := range cs {
+		for _, section := range sections {
+			if c.Section() == section {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Diff returns the changes between current and new. Paths are built from the
+// yaml keys, fields tagged with `yaml:"-"` are ignored and values of fields
+// tagged with `conform:"redact"` are flagged as redacted.
+func Diff(current *Cerberus, new *Cerberus) Changes {
+	var changes Changes
+
+	diffValue(&changes, "", reflect.ValueOf(current).Elem(), reflect.ValueOf(new).Elem(), false)
+
+	return changes
+}
+
+func diffValue(changes *Changes, path string, a reflect.Value, b reflect.Value, redacted bool) {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() && b.IsNil() {
+			return
+		}
+
+		// Compare set structs to their zero value to report their fields
+		if a.IsNil() != b.IsNil() && a.Type().Elem().Kind() != reflect.Struct {
+			*changes = append(*changes, newChange(path, a, b, redacted))
+			return
+		}
+
+		diffValue(changes, path, indirect(a), indirect(b), redacted)
+
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			key := fieldKey(field)
+
+			if key == "-" || len(field.PkgPath) > 0 {
+				continue
+			}
+
+			fieldPath := key
+			if len(path) > 0 {
+				fieldPath = path + "." + key
+			}
+
+			fieldRedacted := redacted || strings.Contains(field.Tag.Get("conform"), "redact")
+			diffValue(changes, fieldPath, a.Field(i), b.Field(i), fieldRedacted)
+		}
+
+	case reflect.Slice:
+		if a.Type().Elem().Kind() != reflect.Struct && a.Type().Elem().Kind() != reflect.Ptr {
+			if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+				*changes = append(*changes, newChange(path, a, b, redacted))
+			}
+			return
+		}
+
+		for i := 0; i < a.Len() || i < b.Len(); i++ {
+			indexPath := fmt.Sprintf("%s[%d]", path, i)
+
+			switch {
+			case i >= a.Len():
+				diffValue(changes, indexPath, reflect.Zero(b.Index(i).Type()), b.Index(i), redacted)
+			case i >= b.Len():
+				diffValue(changes, indexPath, a.Index(i), reflect.Zero(a.Index(i).Type()), redacted)
+			default:
+				diffValue(changes, indexPath, a.Index(i), b.Index(i), redacted)
+			}
+		}
+
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*changes = append(*changes, newChange(path, a, b, redacted))
+		}
+	}
+}
+
+// indirect returns the value pointed to by v or the zero value of its type if
+// v is nil.
+func indirect(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return reflect.Zero(v.Type().Elem())
+	}
+
+	return v.Elem()
+}
+
+func newChange(path string, a reflect.Value, b reflect.Value, redacted bool) Change {
+	c := Change{
+		Path:     path,
+		Redacted: redacted || containsRedacted(a) || containsRedacted(b),
+	}
+
+	if a.IsValid() {
+		c.Old = a.Interface()
+	}
+
+	if b.IsValid() {
+		c.New = b.Interface()
+	}
+
+	return c
+}
+
+// containsRedacted reports whether v is, or holds, a struct with a field
+// tagged with `conform:"redact"`.
+func containsRedacted(v reflect.Value) bool {
+	if !v.IsValid() {
+		return false
+	}
+
+	return typeContainsRedacted(v.Type(), map[reflect.Type]bool{})
+}
+
+func typeContainsRedacted(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return typeContainsRedacted(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if strings.Contains(t.Field(i).Tag.Get("conform"), "redact") || typeContainsRedacted(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// fieldKey returns the yaml key of field.
+func fieldKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+
+	if len(key) == 0 {
+		return strings.ToLower(field.Name)
+	}
+
+	return key
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<nil>"
+	}
+
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "<nil>"
+		}
+
+		v = rv.Elem().Interface()
+	}
+
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%+v", v)
+	}
+}
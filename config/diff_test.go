@@ -0,0 +1,104 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		current *Cerberus
+		new     *Cerberus
+		want    []string
+	}{
+		{
+			name:    "identical",
+			current: &Cerberus{ListeningAddress: ":8080"},
+			new:     &Cerberus{ListeningAddress: ":8080"},
+			want:    nil,
+		},
+		{
+			name:    "scalar",
+			current: &Cerberus{ListeningAddress: ":8080"},
+			new:     &Cerberus{ListeningAddress: ":9090"},
+			want:    []string{`address: ":8080" -> ":9090"`},
+		},
+		{
+			name:    "nested",
+			current: &Cerberus{Health: Health{CheckInterval: time.Second}},
+			new:     &Cerberus{Health: Health{CheckInterval: time.Minute}},
+			want:    []string{"health.check_interval: 1s -> 1m0s"},
+		},
+		{
+			name:    "set pointer to struct",
+			current: &Cerberus{},
+			new:     &Cerberus{Tracing: &Tracing{Exporter: "stdout"}},
+			want:    []string{`tracing.exporter: "" -> "stdout"`},
+		},
+		{
+			name:    "ignored field",
+			current: &Cerberus{Reloads: 1, Audit: &Audit{EffectivePolicyVersion: "a"}},
+			new:     &Cerberus{Reloads: 2, Audit: &Audit{EffectivePolicyVersion: "b"}},
+			want:    nil,
+		},
+		{
+			name:    "redacted field",
+			current: &Cerberus{Slack: Slack{Token: "xoxb-1"}},
+			new:     &Cerberus{Slack: Slack{Token: "xoxb-2"}},
+			want:    []string{"slack.token: <redacted> -> <redacted>"},
+		},
+		{
+			name:    "slice of scalars",
+			current: &Cerberus{Welcome: &Welcome{Channels: []string{"team-*"}}},
+			new:     &Cerberus{Welcome: &Welcome{Channels: []string{"team-*", "squad-*"}}},
+			want:    []string{`welcome.channels: [team-*] -> [team-* squad-*]`},
+		},
+		{
+			name:    "appended struct",
+			current: &Cerberus{UserGroups: &UserGroups{}},
+			new:     &Cerberus{UserGroups: &UserGroups{Groups: []UserGroup{{Handle: "ops"}}}},
+			want:    []string{`usergroups.groups[0].handle: "" -> "ops"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+
+			for _, change := range Diff(test.current, test.new) {
+				got = append(got, change.String())
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Diff() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestChangesTouch(t *testing.T) {
+	changes := Changes{
+		{Path: "health.check_interval"},
+		{Path: "usergroups.groups[0].handle"},
+	}
+
+	tests := []struct {
+		sections []string
+		want     bool
+	}{
+		{sections: []string{"health"}, want: true},
+		{sections: []string{"usergroups"}, want: true},
+		{sections: []string{"tracing", "health"}, want: true},
+		{sections: []string{"tracing"}, want: false},
+		{sections: []string{"health.check_interval"}, want: false},
+		{sections: nil, want: false},
+	}
+
+	for _, test := range tests {
+		if got := changes.Touch(test.sections...); got != test.want {
+			t.Errorf("Touch(%q) = %v, want %v", test.sections, got, test.want)
+		}
+	}
+}
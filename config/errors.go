@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+)
+
+// PathError is a validation error related to a config key. Path is made of
+// the yaml keys leading to the value, e.g. `cerberus_mention.messages[0].text`.
+type PathError struct {
+	Path string
+	Err  error
+}
+
+// Error implements error
+func (e *PathError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// pathErrorf returns a *PathError for path formatted according to format.
+func pathErrorf(path string, format string, args ...interface{}) error {
+	return &PathError{
+		Path: path,
+		Err:  fmt.Errorf(format, args...),
+	}
+}
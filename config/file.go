@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	toml "github.com/BurntSushi/toml"
+	json "github.com/tailscale/hujson"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	pathSegmentRegexp = regexp.MustCompile(`([^.\[\]]+)|\[(\d+)\]`)
+)
+
+// LoadFile parses file into conf the same way github.com/sylr/go-libqd/config
+// does, the format is guessed from the file extension.
+func LoadFile(conf *Cerberus, file string) ([]byte, error) {
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, conf)
+	case ".json":
+		err = json.Unmarshal(content, conf)
+	case ".toml":
+		err = toml.Unmarshal(content, conf)
+	default:
+		err = fmt.Errorf("unknown config file extension `%s`", filepath.Ext(file))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+
+	return content, nil
+}
+
+// YAMLLine returns the line of the YAML document content holding the value at
+// path, or the line of its closest existing parent. It returns 0 if the line
+// can not be found.
+func YAMLLine(content []byte, path string) int {
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Content) == 0 {
+		return 0
+	}
+
+	node := doc.Content[0]
+	line := node.Line
+
+	for _, match := range pathSegmentRegexp.FindAllStringSubmatch(path, -1) {
+		var next *yaml.Node
+
+		switch {
+		case len(match[1]) > 0 && node.Kind == yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == match[1] {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case len(match[2]) > 0 && node.Kind == yaml.SequenceNode:
+			index, _ := strconv.Atoi(match[2])
+
+			if index < len(node.Content) {
+				next = node.Content[index]
+				line = next.Line
+			}
+		}
+
+		if next == nil {
+			break
+		}
+
+		node = next
+	}
+
+	return line
+}
+
+// IsYAMLFile reports whether file has a YAML extension.
+func IsYAMLFile(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+
+	return ext == ".yaml" || ext == ".yml"
+}
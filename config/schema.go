@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"time"
+)
+
+const (
+	jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Schema returns the JSON Schema of the Cerberus config file built from the
+// yaml keys of the config structs. Fields which can only be set from the
+// command line are left out.
+func Schema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(Cerberus{}))
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = "Cerberus configuration"
+
+	return schema
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == durationType {
+		return map[string]interface{}{
+			"type":    []string{"string", "integer"},
+			"pattern": durationPattern,
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+
+			if _, ok := field.Tag.Lookup("yaml"); !ok || len(field.PkgPath) > 0 {
+				continue
+			}
+
+			key := fieldKey(field)
+
+			if key == "-" {
+				continue
+			}
+
+			properties[key] = typeSchema(field.Type)
+		}
+
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	qdconfig "github.com/sylr/go-libqd/config"
+)
+
+var (
+	secretEnvRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+const secretFilePrefix = "file://"
+
+// ResolveSecret returns the secret referenced by value. `${NAME}` patterns are
+// replaced by the content of the NAME environment variable and values
+// starting with "file://" are replaced by the content of the file, trailing
+// new lines excluded. Other values are returned as is.
+func ResolveSecret(value string) (string, error) {
+	var errs []string
+
+	value = secretEnvRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		name := secretEnvRegexp.FindStringSubmatch(match)[1]
+		env, ok := os.LookupEnv(name)
+
+		if !ok {
+			errs = append(errs, fmt.Sprintf("environment variable %s is not set", name))
+		}
+
+		return env
+	})
+
+	if len(errs) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+
+	if strings.HasPrefix(value, secretFilePrefix) {
+		content, err := ioutil.ReadFile(strings.TrimPrefix(value, secretFilePrefix))
+
+		if err != nil {
+			return "", err
+		}
+
+		value = strings.TrimRight(string(content), "\r\n")
+	}
+
+	return value, nil
+}
+
+// SecretsValidator resolves the secret references of the fields tagged with
+// `conform:"redact"`. It runs on every reload so that rotated secret files are
+// read again.
+func (s *Safe) SecretsValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	newConf := newConfig.(*Cerberus)
+
+	return resolveSecrets("", reflect.ValueOf(newConf).Elem(), false)
+}
+
+func resolveSecrets(path string, v reflect.Value, secret bool) []error {
+	var errs []error
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			errs = append(errs, resolveSecrets(path, v.Elem(), secret)...)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key := fieldKey(field)
+
+			if key == "-" || len(field.PkgPath) > 0 {
+				continue
+			}
+
+			fieldPath := key
+			if len(path) > 0 {
+				fieldPath = path + "." + key
+			}
+
+			fieldSecret := strings.Contains(field.Tag.Get("conform"), "redact")
+			errs = append(errs, resolveSecrets(fieldPath, v.Field(i), fieldSecret)...)
+		}
+
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, resolveSecrets(fmt.Sprintf("%s[%d]", path, i), v.Index(i), secret)...)
+		}
+
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			errs = append(errs, resolveSecrets(fmt.Sprintf("%s.%v", path, key.Interface()), elem, secret)...)
+			v.SetMapIndex(key, elem)
+		}
+
+	case reflect.String:
+		if !secret {
+			break
+		}
+
+		value, err := ResolveSecret(v.String())
+
+		if err != nil {
+			errs = append(errs, &PathError{Path: path, Err: err})
+			break
+		}
+
+		v.SetString(value)
+	}
+
+	return errs
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	toml "github.com/BurntSushi/toml"
+	qdconfig "github.com/sylr/go-libqd/config"
+	json "github.com/tailscale/hujson"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// UnknownKeys parses file and returns an error for every key which does not
+// match a config field.
+func UnknownKeys(file string) []error {
+	var errs []error
+
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return []error{err}
+	}
+
+	conf := &Cerberus{}
+
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+
+		if err := decoder.Decode(conf); err != nil {
+			if typeErr, ok := err.(*yaml.TypeError); ok {
+				for _, msg := range typeErr.Errors {
+					errs = append(errs, fmt.Errorf("%s", msg))
+				}
+			} else {
+				errs = append(errs, err)
+			}
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(conf); err != nil {
+			errs = append(errs, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), conf)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, key := range meta.Undecoded() {
+			errs = append(errs, pathErrorf(key.String(), "unknown key"))
+		}
+	}
+
+	return errs
+}
+
+// StrictValidator rejects config files holding unknown keys when strict mode
+// is enabled.
+func (s *Safe) StrictValidator(currentConfig qdconfig.Config, newConfig qdconfig.Config) []error {
+	newConf := newConfig.(*Cerberus)
+
+	if !newConf.Strict || len(newConf.File) == 0 {
+		return nil
+	}
+
+	return UnknownKeys(newConf.File)
+}
@@ -3,16 +3,23 @@ module github.com/sylr/cerberus
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/go-ldap/ldap/v3 v3.4.1
 	github.com/gorilla/mux v1.7.4
 	github.com/jessevdk/go-flags v1.4.0
 	github.com/leebenson/conform v1.2.2
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/prometheus/client_golang v1.7.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/sirupsen/logrus v1.6.0
 	github.com/slack-go/slack v0.6.6
 	github.com/sylr/go-libqd/cache v0.1.1
 	github.com/sylr/go-libqd/config v0.3.1
-	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
-	google.golang.org/protobuf v1.25.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
+	github.com/tailscale/hujson v0.0.0-20190930033718-5098e564d9b3
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 )
@@ -3,19 +3,35 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/audit"
+	"github.com/sylr/cerberus/pkg/health"
 	crbhttp "github.com/sylr/cerberus/pkg/http"
 	"github.com/sylr/cerberus/pkg/http/handlers/safewrapper"
+	"github.com/sylr/cerberus/pkg/membership"
+	"github.com/sylr/cerberus/pkg/recorder"
+	"github.com/sylr/cerberus/pkg/scheduler"
+	"github.com/sylr/cerberus/pkg/slack"
+	"github.com/sylr/cerberus/pkg/state"
+	"github.com/sylr/cerberus/pkg/throttle"
+	"github.com/sylr/cerberus/pkg/tracing"
+	"github.com/sylr/cerberus/pkg/worker"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/leebenson/conform"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	qdconfig "github.com/sylr/go-libqd/config"
+
+	// Job actions
+	_ "github.com/sylr/cerberus/pkg/reconcile"
+	_ "github.com/sylr/cerberus/pkg/report"
+	_ "github.com/sylr/cerberus/pkg/usergroups"
 )
 
 var (
@@ -35,12 +51,23 @@ var (
 	)
 )
 
+var (
+	// commands are the subcommands handled instead of running the server
+	commands = map[string]func(args []string) int{
+		"config":     configCommand,
+		"replay":     replayCommand,
+		"usergroups": usergroupsCommand,
+	}
+)
+
 func init() {
 	// Parse arguments to set the desirend log level as soon as possible
 	conf := &config.Cerberus{}
 	parser := flags.NewParser(conf, flags.Default)
 
-	if _, err := parser.Parse(); err == nil {
+	if isCommand() {
+		log.SetLevel(log.InfoLevel)
+	} else if _, err := parser.Parse(); err == nil {
 		// Update logging level
 		switch {
 		case len(conf.Verbose) == 1:
@@ -55,14 +82,13 @@ func init() {
 		log.SetLevel(log.InfoLevel)
 	}
 
-	// Log as JSON instead of the default ASCII formatter.
+	// Log as text until the configured format is applied
 	log.SetFormatter(&log.TextFormatter{
 		DisableColors:  true,
 		DisableSorting: false,
 	})
 
-	// Output to stdout instead of the default stderr
-	// Can be any io.Writer, see below for File example
+	// Output to stdout until the configured output is applied
 	log.SetOutput(os.Stdout)
 
 	// Set & Register build info metric
@@ -79,7 +105,23 @@ func init() {
 	conform.AddSanitizer("redact", redact)
 }
 
+// isCommand reports whether the first argument is a subcommand
+func isCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+
+	_, ok := commands[os.Args[1]]
+
+	return ok
+}
+
 func main() {
+	// Subcommands
+	if isCommand() {
+		os.Exit(commands[os.Args[1]](os.Args[2:]))
+	}
+
 	// looping for --version in args
 	for _, val := range os.Args {
 		if val == "--version" {
@@ -95,8 +137,8 @@ func main() {
 	safe := &config.Safe{Logger: log.StandardLogger()}
 	ctx := context.Background()
 
-	configManager.AddValidators(nil, safe.ListeningAddressValidator, safe.LogValidator)
-	configManager.AddAppliers(nil, safe.LogApplier, safe.ReloadApplier)
+	configManager.AddValidators(nil, safe.Validators(safe.DefaultValidators()...))
+	configManager.AddAppliers(nil, safe.Appliers(safe.LogApplier), safe.ReloadApplier)
 	err := configManager.MakeConfig(ctx, nil, conf)
 
 	if err != nil {
@@ -114,42 +156,285 @@ func main() {
 		log.Debugf("Configuration %#v", confRedacted)
 	}
 
+	// Tracing
+	tracer := tracing.New(log.StandardLogger())
+
+	if err := tracer.Apply(ctx, conf.Tracing); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	// State store
+	store, err := state.New(conf.State.File, log.StandardLogger())
+
+	if err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	store.Start(conf.State.FlushInterval)
+
+	// Workers
+	pool := worker.New(conf.Workers.Count, conf.Workers.QueueSize, log.StandardLogger())
+
+	// Readiness checks
+	hlth := health.New(log.StandardLogger())
+	hlth.AddCheck("slack_auth", func(ctx context.Context) error {
+		slackClient := slack.NewClient(&configManager.GetConfig(nil).(*config.Cerberus).Slack)
+		_, err := slackClient.AuthTestContext(ctx)
+		return err
+	})
+	hlth.AddCheck("slack_directory", func(ctx context.Context) error {
+		slackClient := slack.NewClient(&configManager.GetConfig(nil).(*config.Cerberus).Slack)
+		_, err := slack.GetUserGroups(ctx, slackClient)
+		return err
+	})
+	hlth.AddCheck("state_store", func(ctx context.Context) error {
+		return store.Writable()
+	})
+	hlth.Start(ctx, conf.Health.CheckInterval, conf.Health.CheckTimeout)
+
+	// Event recorder
+	rec := recorder.New(log.StandardLogger())
+
+	if err := rec.Apply(conf.EventRecorder); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	// Audit log
+	aud := audit.New(log.StandardLogger())
+
+	if err := aud.Apply(conf.Audit); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	// Throttler
+	thr := throttle.New(log.StandardLogger(), store)
+	thr.Apply(conf.Throttle)
+
+	// Membership provider, shared by the event handlers and the jobs
+	mem := membership.New(log.StandardLogger())
+	mem.Apply(ctx, conf)
+
+	// Scheduler
+	sched := scheduler.New(log.StandardLogger(), store)
+	sched.SetContext(membership.WithProvider(ctx, mem))
+
+	if err := sched.Apply(conf); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	// Declared usergroups are synced at startup, then on schedule
+	if conf.UserGroups != nil {
+		_ = sched.Trigger("usergroups_sync")
+	}
+
 	// HTTP router
-	router := crbhttp.NewHTTPRouter(conf, safe)
+	router := crbhttp.NewHTTPRouter(conf, safe, pool, hlth, rec, aud, thr, mem)
 	wrapper := safewrapper.New(router)
 
 	// HTTP Server
-	server := http.Server{
-		Handler:      wrapper,
-		Addr:         conf.ListeningAddress,
-		WriteTimeout: 60 * time.Second,
-		ReadTimeout:  15 * time.Second,
-	}
+	server := crbhttp.NewServer(wrapper, log.StandardLogger())
 
-	go func() {
-		err := server.ListenAndServe()
+	if err := server.Apply(ctx, conf.ListeningAddress, conf.TLS); err != nil {
 		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	// Admin HTTP Server, only listening if an admin address is set
+	adminWrapper := safewrapper.New(crbhttp.NewAdminHTTPRouter(conf, safe, aud))
+	adminServer := crbhttp.NewServer(adminWrapper, log.StandardLogger())
 
+	if err := adminServer.Apply(ctx, conf.AdminAddress, conf.TLS); err != nil {
+		log.Errorf("%v", err)
 		os.Exit(1)
-	}()
+	}
+
+	// apply rebuilds the components whose config changed from current to next
+	apply := func(current, next *config.Cerberus) []error {
+		var errs []error
+		changes := config.Diff(current, next)
+
+		// Readiness checks
+		if changes.Touch("health") {
+			hlth.Start(ctx, next.Health.CheckInterval, next.Health.CheckTimeout)
+		}
+
+		// Tracing
+		if changes.Touch("tracing") {
+			if err := tracer.Apply(ctx, next.Tracing); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		// Event recorder
+		if changes.Touch("event_recorder") {
+			if err := rec.Apply(next.EventRecorder); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		// Audit log
+		if changes.Touch("audit") {
+			if err := aud.Apply(next.Audit); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		// Throttler
+		if changes.Touch("throttle") {
+			thr.Apply(next.Throttle)
+		}
+
+		// Membership provider
+		if changes.Touch("membership", "slack") {
+			mem.Apply(ctx, next)
+		}
+
+		// Scheduler
+		if changes.Touch("scheduler", "report", "audit", "slack", "team_usergroups", "usergroups") {
+			if err := sched.Apply(next); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		// Routers
+		if changes.Touch("admin_address", "admin", "slack", "cerberus_mention", "welcome", "channel_naming", "usergroups") {
+			newRouter := crbhttp.NewHTTPRouter(next, safe, pool, hlth, rec, aud, thr, mem)
+			wrapper.SwapHandler(newRouter)
+		}
+
+		if changes.Touch("admin") {
+			newAdminRouter := crbhttp.NewAdminHTTPRouter(next, safe, aud)
+			adminWrapper.SwapHandler(newAdminRouter)
+		}
+
+		// Hand over to new listeners if addresses or TLS settings changed
+		applyCtx, cancel := context.WithTimeout(ctx, next.ShutdownGrace)
+		defer cancel()
+
+		if changes.Touch("address", "tls") {
+			if err := server.Apply(applyCtx, next.ListeningAddress, next.TLS); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if changes.Touch("admin_address", "tls") {
+			if err := adminServer.Apply(applyCtx, next.AdminAddress, next.TLS); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return errs
+	}
+
+	// Signals
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
 
 	// Replace router when new conf is sent through the config chan
 	configChan := configManager.NewConfigChan(nil)
 	for {
 		select {
-		case newConf := <-configChan:
-			if log.GetLevel() >= log.DebugLevel {
-				confRedacted := newConf.(*config.Cerberus).DeepCopy()
+		case sig := <-signals:
+			log.Infof("Received %s, shutting down", sig)
+
+			ctx, cancel := context.WithTimeout(ctx, conf.ShutdownGrace)
+			code := shutdown(ctx, conf.ShutdownDelay, hlth, server, adminServer, pool, sched, store, rec, tracer)
+			cancel()
+
+			os.Exit(code)
+		case err := <-server.Errors():
+			log.Errorf("%v", err)
+			os.Exit(1)
+		case err := <-adminServer.Errors():
+			log.Errorf("%v", err)
+			os.Exit(1)
+		case newConfig := <-configChan:
+			newConf := newConfig.(*config.Cerberus)
+			changes := config.Diff(conf, newConf)
 
-				if err := conform.Strings(confRedacted); err != nil {
+			for _, change := range changes {
+				log.Infof("Config changed: %s", change)
+			}
+
+			// Components are rolled back to the current config if any fails,
+			// which the next reload diffs against again
+			if errs := apply(conf, newConf); len(errs) > 0 {
+				for _, err := range errs {
 					log.Errorf("%v", err)
 				}
 
-				log.Debugf("Configuration %#v", confRedacted)
+				log.Errorf("Applying new config failed, rolling back to the previous config")
+
+				for _, err := range apply(newConf, conf) {
+					log.Errorf("Rolling back config: %v", err)
+				}
+
+				safe.ReloadFailed(conf)
+				continue
 			}
 
-			newRouter := crbhttp.NewHTTPRouter(newConf.(*config.Cerberus), safe)
-			wrapper.SwapHandler(newRouter)
+			if changes.Touch("usergroups") && newConf.UserGroups != nil {
+				if err := sched.Trigger("usergroups_sync"); err != nil {
+					log.Errorf("%v", err)
+				}
+			}
+
+			conf = newConf.DeepCopy()
 		}
 	}
 }
+
+// shutdown flips readiness, keeps serving for delay so that probes notice it,
+// stops accepting events, drains the worker queue, waits for running jobs and
+// flushes the state store and the pending spans. It returns the process exit
+// code.
+func shutdown(ctx context.Context, delay time.Duration, hlth *health.Health, server *crbhttp.Server, adminServer *crbhttp.Server, pool *worker.Pool, sched *scheduler.Scheduler, store *state.Store, rec *recorder.Recorder, tracer *tracing.Tracing) int {
+	code := 0
+	hlth.SetShuttingDown()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("Shutting down HTTP server: %v", err)
+		code = 1
+	}
+
+	if err := pool.Shutdown(ctx); err != nil {
+		log.Errorf("Draining worker queue: %v", err)
+		code = 1
+	}
+
+	if err := sched.Stop(ctx); err != nil {
+		log.Errorf("Stopping scheduler: %v", err)
+		code = 1
+	}
+
+	if err := store.Close(); err != nil {
+		log.Errorf("Flushing state store: %v", err)
+		code = 1
+	}
+
+	if err := rec.Close(); err != nil {
+		log.Errorf("Closing event recorder: %v", err)
+	}
+
+	if err := tracer.Shutdown(ctx); err != nil {
+		log.Errorf("Flushing spans: %v", err)
+	}
+
+	if err := adminServer.Shutdown(ctx); err != nil {
+		log.Errorf("Shutting down admin HTTP server: %v", err)
+	}
+
+	log.Infof("Shutdown complete")
+
+	return code
+}
@@ -0,0 +1,337 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	filePrefix = "audit-"
+	fileSuffix = ".jsonl"
+	dayLayout  = "2006-01-02"
+)
+
+// Enforcement actions
+const (
+	ActionWarned    = "warned"
+	ActionDeleted   = "deleted"
+	ActionEscalated = "escalated"
+	ActionRenamed   = "renamed"
+)
+
+var (
+	metricAuditEntriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "audit",
+			Name:      "entries_total",
+			Help:      "Number of enforcement decisions written to the audit log",
+		},
+		[]string{"action", "rule"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricAuditEntriesTotal)
+}
+
+// Entry is an enforcement decision
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Action        string    `json:"action"`
+	Rule          string    `json:"rule"`
+	User          string    `json:"user"`
+	Channel       string    `json:"channel"`
+	PolicyVersion string    `json:"policy_version"`
+	Permalink     string    `json:"permalink"`
+	EventID       string    `json:"event_id"`
+}
+
+// Filter selects entries, zero fields match everything
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Action  string
+	Rule    string
+	User    string
+	Channel string
+}
+
+// Match reports whether entry is selected by f
+func (f Filter) Match(entry Entry) bool {
+	switch {
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !entry.Time.Before(f.Until):
+		return false
+	case len(f.Action) > 0 && entry.Action != f.Action:
+		return false
+	case len(f.Rule) > 0 && entry.Rule != f.Rule:
+		return false
+	case len(f.User) > 0 && entry.User != f.User:
+		return false
+	case len(f.Channel) > 0 && entry.Channel != f.Channel:
+		return false
+	}
+
+	return true
+}
+
+// Log appends entries to daily JSONL files and never rewrites them, files
+// older than the retention are deleted as a whole.
+type Log struct {
+	logger *log.Logger
+	conf   *config.Audit
+	day    string
+	mu     sync.Mutex
+}
+
+// New returns a *Log, it does not record anything until Apply is called with a
+// non nil config.
+func New(logger *log.Logger) *Log {
+	return &Log{
+		logger: logger,
+	}
+}
+
+// Apply replaces the audit config, a nil config disables the audit log.
+func (l *Log) Apply(conf *config.Audit) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if conf != nil {
+		if err := os.MkdirAll(conf.Directory, 0750); err != nil {
+			return fmt.Errorf("audit: %w", err)
+		}
+	}
+
+	l.conf = conf.DeepCopy()
+	l.day = ""
+
+	return nil
+}
+
+// Enabled reports whether entries are recorded
+func (l *Log) Enabled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.conf != nil
+}
+
+// Record appends entry to the audit log, Time and PolicyVersion are set if empty.
+func (l *Log) Record(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conf == nil {
+		return nil
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	if len(entry.PolicyVersion) == 0 {
+		entry.PolicyVersion = l.conf.EffectivePolicyVersion
+	}
+
+	entry.Time = entry.Time.UTC()
+	day := entry.Time.Format(dayLayout)
+
+	if day != l.day {
+		l.day = day
+
+		if err := l.prune(entry.Time); err != nil {
+			l.logger.Errorf("audit: %v", err)
+		}
+	}
+
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	name := filepath.Join(l.conf.Directory, filePrefix+day+fileSuffix)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	metricAuditEntriesTotal.WithLabelValues(entry.Action, entry.Rule).Inc()
+
+	return nil
+}
+
+// Query returns the entries matching filter, oldest first.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []Entry
+
+	if l.conf == nil {
+		return entries, nil
+	}
+
+	files, err := l.files()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		day, err := fileDay(file)
+
+		if err != nil {
+			continue
+		}
+
+		if !filter.Since.IsZero() && day.Add(24*time.Hour).Before(filter.Since) {
+			continue
+		}
+
+		if !filter.Until.IsZero() && day.After(filter.Until) {
+			continue
+		}
+
+		if entries, err = readEntries(file, filter, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// prune deletes the files older than the retention
+func (l *Log) prune(now time.Time) error {
+	files, err := l.files()
+
+	if err != nil {
+		return err
+	}
+
+	limit := now.Add(-l.conf.Retention)
+
+	for _, file := range files {
+		day, err := fileDay(file)
+
+		if err != nil || !day.Add(24*time.Hour).Before(limit) {
+			continue
+		}
+
+		l.logger.Infof("audit: deleting %s", file)
+
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// files returns the audit files sorted by day
+func (l *Log) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(l.conf.Directory, filePrefix+"*"+fileSuffix))
+
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// fileDay returns the day of an audit file
+func fileDay(file string) (time.Time, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), filePrefix), fileSuffix)
+
+	return time.Parse(dayLayout, name)
+}
+
+// readEntries appends the entries of file matching filter to entries
+func readEntries(file string, filter Filter, entries []Entry) ([]Entry, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		var entry Entry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("audit: %s: %w", file, err)
+		}
+
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("audit: %s: %w", file, err)
+	}
+
+	return entries, nil
+}
+
+type contextKey struct{}
+
+// scope is the audit log and event carried by a context
+type scope struct {
+	log     *Log
+	eventID string
+}
+
+// WithLog returns a copy of ctx carrying l and the ID of the event being
+// handled.
+func WithLog(ctx context.Context, l *Log, eventID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, scope{log: l, eventID: eventID})
+}
+
+// Record appends entry to the audit log carried by ctx, if any. EventID is set
+// if empty.
+func Record(ctx context.Context, entry Entry) error {
+	s, ok := ctx.Value(contextKey{}).(scope)
+
+	if !ok || s.log == nil {
+		return nil
+	}
+
+	if len(entry.EventID) == 0 {
+		entry.EventID = s.eventID
+	}
+
+	return s.log.Record(entry)
+}
@@ -0,0 +1,221 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	metricHealthCheckStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "health",
+			Name:      "check_status",
+			Help:      "Status of the readiness checks (1 ok, 0 failing)",
+		},
+		[]string{"check"},
+	)
+
+	metricHealthReady = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "health",
+			Name:      "ready",
+			Help:      "Readiness of the process (1 ready, 0 not ready)",
+		},
+		[]string{},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricHealthCheckStatus)
+	prometheus.MustRegister(metricHealthReady)
+}
+
+// Check is a readiness check, it returns an error when failing.
+type Check func(ctx context.Context) error
+
+// Health tracks the readiness of the process. Checks are run periodically and
+// their results are cached so that probes do not hit external services.
+type Health struct {
+	logger       *log.Logger
+	shuttingDown int32
+	checks       map[string]Check
+	results      map[string]error
+	cancel       context.CancelFunc
+	mu           sync.RWMutex
+}
+
+// New returns a *Health
+func New(logger *log.Logger) *Health {
+	return &Health{
+		logger:  logger,
+		checks:  make(map[string]Check),
+		results: make(map[string]error),
+	}
+}
+
+// AddCheck registers a readiness check. Checks are failing until they have
+// run once.
+func (h *Health) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	h.checks[name] = check
+	h.results[name] = fmt.Errorf("not checked yet")
+	h.mu.Unlock()
+
+	metricHealthCheckStatus.WithLabelValues(name).Set(0)
+}
+
+// Start runs the checks right away and then every interval until ctx is done.
+// Calling it again replaces the previous loop, e.g. when the interval or the
+// timeout changed.
+func (h *Health) Start(ctx context.Context, interval time.Duration, timeout time.Duration) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	h.mu.Lock()
+	if h.cancel != nil {
+		h.cancel()
+	}
+	h.cancel = cancel
+	h.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			h.runChecks(ctx, timeout)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runChecks runs all the checks and caches their results.
+func (h *Health) runChecks(ctx context.Context, timeout time.Duration) {
+	h.mu.RLock()
+	checks := make(map[string]Check, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	for name, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := check(checkCtx)
+		cancel()
+
+		// The loop has been replaced or stopped, the check has been interrupted
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			h.logger.Warnf("Readiness check %s failed: %v", name, err)
+			metricHealthCheckStatus.WithLabelValues(name).Set(0)
+		} else {
+			metricHealthCheckStatus.WithLabelValues(name).Set(1)
+		}
+
+		h.mu.Lock()
+		h.results[name] = err
+		h.mu.Unlock()
+	}
+
+	h.updateReadyMetric()
+}
+
+// SetShuttingDown marks the process as shutting down, it will not be ready
+// anymore.
+func (h *Health) SetShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+	h.updateReadyMetric()
+}
+
+// ShuttingDown reports whether SetShuttingDown has been called.
+func (h *Health) ShuttingDown() bool {
+	return atomic.LoadInt32(&h.shuttingDown) == 1
+}
+
+// Ready reports whether the process is not shutting down and all the checks
+// passed.
+func (h *Health) Ready() bool {
+	if h.ShuttingDown() {
+		return false
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, err := range h.results {
+		if err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *Health) updateReadyMetric() {
+	if h.Ready() {
+		metricHealthReady.WithLabelValues().Set(1)
+	} else {
+		metricHealthReady.WithLabelValues().Set(0)
+	}
+}
+
+// HealthHandler returns an http.Handler answering 200 as long as the process
+// is able to serve HTTP requests.
+func (h *Health) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
+
+// ReadyHandler returns an http.Handler answering 200 when ready and 503
+// otherwise. The body lists the status of the checks, their errors are only
+// logged as it may be served publicly.
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		if h.Ready() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		if h.ShuttingDown() {
+			_, _ = w.Write([]byte("shutting down\n"))
+		}
+
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+
+		names := make([]string, 0, len(h.results))
+		for name := range h.results {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if h.results[name] != nil {
+				fmt.Fprintf(w, "%s: failing\n", name)
+			} else {
+				fmt.Fprintf(w, "%s: ok\n", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	crbaudit "github.com/sylr/cerberus/pkg/audit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// csvHeader is the first line of CSV exports
+var csvHeader = []string{"time", "action", "rule", "user", "channel", "policy_version", "permalink", "event_id"}
+
+// Handler is a http.Handler querying the audit log.
+//
+// Entries are filtered with the since, until, action, rule, user and channel
+// query parameters, since and until being RFC3339 times or dates. They are
+// exported as JSONL, or as CSV if format=csv.
+type Handler struct {
+	log    *crbaudit.Log
+	logger *log.Logger
+}
+
+// New returns a *Handler querying l
+func New(l *crbaudit.Log, logger *log.Logger) *Handler {
+	h := Handler{
+		log:    l,
+		logger: logger,
+	}
+
+	return &h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.log.Enabled() {
+		http.Error(w, "audit log disabled", http.StatusNotFound)
+		return
+	}
+
+	filter, err := parseFilter(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.log.Query(filter)
+
+	if err != nil {
+		h.logger.Errorf("%v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		writer := csv.NewWriter(w)
+		_ = writer.Write(csvHeader)
+
+		for _, e := range entries {
+			_ = writer.Write([]string{
+				e.Time.Format(time.RFC3339), e.Action, e.Rule, e.User, e.Channel, e.PolicyVersion, e.Permalink, e.EventID,
+			})
+		}
+
+		writer.Flush()
+	case "", "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+
+		for _, e := range entries {
+			_ = encoder.Encode(e)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unknown format `%s`", format), http.StatusBadRequest)
+	}
+}
+
+// parseFilter returns the filter described by the query parameters of r
+func parseFilter(r *http.Request) (crbaudit.Filter, error) {
+	var err error
+	query := r.URL.Query()
+	filter := crbaudit.Filter{
+		Action:  query.Get("action"),
+		Rule:    query.Get("rule"),
+		User:    query.Get("user"),
+		Channel: query.Get("channel"),
+	}
+
+	if filter.Since, err = parseTime(query.Get("since")); err != nil {
+		return filter, fmt.Errorf("since: %w", err)
+	}
+
+	if filter.Until, err = parseTime(query.Get("until")); err != nil {
+		return filter, fmt.Errorf("until: %w", err)
+	}
+
+	return filter, nil
+}
+
+// parseTime parses RFC3339 times and dates, an empty value is the zero time
+func parseTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
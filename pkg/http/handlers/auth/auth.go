@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sylr/cerberus/config"
+)
+
+// Auth is a http.Handler which wraps another http.Handler and only lets
+// through requests matching the given config.HTTPAuth.
+type Auth struct {
+	handler  http.Handler
+	conf     *config.HTTPAuth
+	networks []*net.IPNet
+}
+
+// New returns a *Auth protecting handler with conf. If conf is nil all requests
+// are let through.
+func New(handler http.Handler, conf *config.HTTPAuth) *Auth {
+	h := Auth{
+		handler: handler,
+		conf:    conf,
+	}
+
+	if conf != nil {
+		// Networks have already been checked by config.Safe.AdminValidator
+		h.networks, _ = config.ParseNetworks(conf.AllowedNetworks)
+	}
+
+	return &h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Auth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.conf == nil {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if !h.allowedNetwork(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if !h.authenticated(r) {
+		if h.conf.BasicAuth != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cerberus"`)
+		}
+
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+// allowedNetwork returns true if no network restriction is configured or if
+// the remote address belongs to one of the allowed networks.
+func (h *Auth) allowedNetwork(r *http.Request) bool {
+	if len(h.networks) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range h.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authenticated returns true if no credentials are configured or if the
+// request carries valid basic auth credentials or a valid bearer token.
+func (h *Auth) authenticated(r *http.Request) bool {
+	if h.conf.BasicAuth == nil && len(h.conf.BearerToken) == 0 {
+		return true
+	}
+
+	if h.conf.BasicAuth != nil {
+		username, password, ok := r.BasicAuth()
+
+		if ok && secureCompare(username, h.conf.BasicAuth.Username) && secureCompare(password, h.conf.BasicAuth.Password) {
+			return true
+		}
+	}
+
+	if len(h.conf.BearerToken) > 0 {
+		authorization := r.Header.Get("Authorization")
+
+		if strings.HasPrefix(authorization, "Bearer ") && secureCompare(strings.TrimPrefix(authorization, "Bearer "), h.conf.BearerToken) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func secureCompare(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sylr/cerberus/config"
+)
+
+func TestAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	basic := &config.BasicAuth{Username: "admin", Password: "secret"}
+
+	tests := []struct {
+		name          string
+		conf          *config.HTTPAuth
+		remoteAddr    string
+		username      string
+		password      string
+		authorization string
+		want          int
+	}{
+		{
+			name: "no config",
+			want: http.StatusOK,
+		},
+		{
+			name:       "allowed network",
+			conf:       &config.HTTPAuth{AllowedNetworks: []string{"10.0.0.0/8", "192.168.1.1"}},
+			remoteAddr: "10.1.2.3:4567",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "allowed address",
+			conf:       &config.HTTPAuth{AllowedNetworks: []string{"10.0.0.0/8", "192.168.1.1"}},
+			remoteAddr: "192.168.1.1:4567",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "allowed IPv6 network",
+			conf:       &config.HTTPAuth{AllowedNetworks: []string{"fd00::/8"}},
+			remoteAddr: "[fd00::1]:4567",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "denied network",
+			conf:       &config.HTTPAuth{AllowedNetworks: []string{"10.0.0.0/8", "192.168.1.1"}},
+			remoteAddr: "192.168.1.2:4567",
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "basic auth",
+			conf:       &config.HTTPAuth{BasicAuth: basic},
+			remoteAddr: "10.1.2.3:4567",
+			username:   "admin",
+			password:   "secret",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "basic auth wrong password",
+			conf:       &config.HTTPAuth{BasicAuth: basic},
+			remoteAddr: "10.1.2.3:4567",
+			username:   "admin",
+			password:   "guess",
+			want:       http.StatusUnauthorized,
+		},
+		{
+			name:       "basic auth missing",
+			conf:       &config.HTTPAuth{BasicAuth: basic},
+			remoteAddr: "10.1.2.3:4567",
+			want:       http.StatusUnauthorized,
+		},
+		{
+			name:          "bearer token",
+			conf:          &config.HTTPAuth{BearerToken: "token"},
+			remoteAddr:    "10.1.2.3:4567",
+			authorization: "Bearer token",
+			want:          http.StatusOK,
+		},
+		{
+			name:          "bearer token wrong",
+			conf:          &config.HTTPAuth{BearerToken: "token"},
+			remoteAddr:    "10.1.2.3:4567",
+			authorization: "Bearer other",
+			want:          http.StatusUnauthorized,
+		},
+		{
+			name:          "bearer token without scheme",
+			conf:          &config.HTTPAuth{BearerToken: "token"},
+			remoteAddr:    "10.1.2.3:4567",
+			authorization: "token",
+			want:          http.StatusUnauthorized,
+		},
+		{
+			name:          "bearer token or basic auth",
+			conf:          &config.HTTPAuth{BasicAuth: basic, BearerToken: "token"},
+			remoteAddr:    "10.1.2.3:4567",
+			authorization: "Bearer token",
+			want:          http.StatusOK,
+		},
+		{
+			name:          "credentials from denied network",
+			conf:          &config.HTTPAuth{BearerToken: "token", AllowedNetworks: []string{"10.0.0.0/8"}},
+			remoteAddr:    "192.168.1.2:4567",
+			authorization: "Bearer token",
+			want:          http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			r.RemoteAddr = test.remoteAddr
+
+			if len(test.username) > 0 {
+				r.SetBasicAuth(test.username, test.password)
+			}
+
+			if len(test.authorization) > 0 {
+				r.Header.Set("Authorization", test.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			New(ok, test.conf).ServeHTTP(w, r)
+
+			if w.Code != test.want {
+				t.Errorf("status = %d, want %d", w.Code, test.want)
+			}
+
+			if w.Code == http.StatusUnauthorized && test.conf.BasicAuth != nil && len(w.Header().Get("WWW-Authenticate")) == 0 {
+				t.Errorf("WWW-Authenticate header not set")
+			}
+		})
+	}
+}
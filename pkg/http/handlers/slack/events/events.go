@@ -2,17 +2,28 @@ package events
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/audit"
+	"github.com/sylr/cerberus/pkg/logging"
+	"github.com/sylr/cerberus/pkg/membership"
+	"github.com/sylr/cerberus/pkg/recorder"
 	"github.com/sylr/cerberus/pkg/slack/actions"
+	"github.com/sylr/cerberus/pkg/throttle"
+	"github.com/sylr/cerberus/pkg/tracing"
+	"github.com/sylr/cerberus/pkg/worker"
 
 	log "github.com/sirupsen/logrus"
 	goslack "github.com/slack-go/slack"
 	goslackevents "github.com/slack-go/slack/slackevents"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -36,12 +47,45 @@ var (
 		[]string{"type"},
 	)
 
+	metricEventsHandlingDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cerberus",
+			Subsystem: "slack_events",
+			Name:      "handling_duration_seconds",
+			Help:      "Time between the reception of slack events and the end of their processing",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"type"},
+	)
+
+	metricEventsLagSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "slack_events",
+			Name:      "lag_seconds",
+			Help:      "Time between the last slack event occurrence and its reception",
+		},
+		[]string{"type"},
+	)
+
+	metricActionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "actions",
+			Name:      "runs_total",
+			Help:      "Number of actions run by outcome (performed, skipped or error)",
+		},
+		[]string{"action", "outcome"},
+	)
+
+	// Deprecated: replaced by metricActionsTotal, to be removed in the next
+	// release
 	metricActionPerformedTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "cerberus",
 			Subsystem: "actions",
 			Name:      "performed_total",
-			Help:      "Number of actions performed",
+			Help:      "Number of actions performed (deprecated, use cerberus_actions_runs_total)",
 		},
 		[]string{"type"},
 	)
@@ -50,6 +94,9 @@ var (
 func init() {
 	prometheus.MustRegister(metricEventsReceivedTotal)
 	prometheus.MustRegister(metricEventsUnhandledTotal)
+	prometheus.MustRegister(metricEventsHandlingDuration)
+	prometheus.MustRegister(metricEventsLagSeconds)
+	prometheus.MustRegister(metricActionsTotal)
 	prometheus.MustRegister(metricActionPerformedTotal)
 }
 
@@ -58,29 +105,45 @@ type Handler struct {
 	Config      *config.Cerberus
 	Logger      *log.Logger
 	SlackClient *goslack.Client
+	Pool        *worker.Pool
+	Recorder    *recorder.Recorder
+	Audit       *audit.Log
+	Throttler   *throttle.Throttler
+	Membership  membership.MembershipProvider
 
 	AppMentionEventActions     []actions.Actionner
 	MessageEventActions        []actions.Actionner
 	SubteamUpdatedEventActions []actions.Actionner
+	MemberJoinedEventActions   []actions.Actionner
+	ChannelEventActions        []actions.Actionner
 }
 
 // NewHandler ...
-func NewHandler(conf *config.Cerberus, logger *log.Logger, slackClient *goslack.Client) *Handler {
+func NewHandler(conf *config.Cerberus, logger *log.Logger, slackClient *goslack.Client, pool *worker.Pool, rec *recorder.Recorder, aud *audit.Log, thr *throttle.Throttler, mem membership.MembershipProvider) *Handler {
 	h := Handler{
 		Config:      conf,
 		Logger:      logger,
 		SlackClient: slackClient,
+		Pool:        pool,
+		Recorder:    rec,
+		Audit:       aud,
+		Throttler:   thr,
+		Membership:  mem,
 	}
 
 	h.AppMentionEventActions = append(h.AppMentionEventActions, actions.NewCerberusMention(conf, logger, slackClient))
 	h.MessageEventActions = append(h.MessageEventActions, actions.NewAtChannelMention(conf, logger, slackClient))
 	h.SubteamUpdatedEventActions = append(h.SubteamUpdatedEventActions, actions.NewSubteamUpdated(conf, logger, slackClient))
+	h.SubteamUpdatedEventActions = append(h.SubteamUpdatedEventActions, actions.NewManagedUserGroup(conf, logger, slackClient))
+	h.MemberJoinedEventActions = append(h.MemberJoinedEventActions, actions.NewWelcomeMember(conf, logger, slackClient))
+	h.ChannelEventActions = append(h.ChannelEventActions, actions.NewChannelNaming(conf, logger, slackClient))
 
 	return &h
 }
 
 // ServeHTTP ...
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
 	buf := new(bytes.Buffer)
 	_, err := buf.ReadFrom(r.Body)
 
@@ -90,6 +153,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Request signature
+	if len(h.Config.Slack.SigningSecret) > 0 {
+		verifier, err := goslack.NewSecretsVerifier(r.Header, h.Config.Slack.SigningSecret)
+
+		if err == nil {
+			_, _ = verifier.Write(buf.Bytes())
+			err = verifier.Ensure()
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			h.Logger.Warnf("Invalid request signature: %v", err)
+			return
+		}
+	}
+
 	js := json.RawMessage(buf.Bytes())
 	token := goslackevents.OptionNoVerifyToken()
 	eventsAPIEvent, err := goslackevents.ParseEvent(js, token)
@@ -102,67 +181,30 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.Logger.Debugf("eventsAPIEvent.Type=%v", eventsAPIEvent.Type)
+	trace.SpanFromContext(r.Context()).SetAttributes(eventAttributes(eventsAPIEvent)...)
 
-	// Callback event
+	// Callback event, acknowledged right away and processed by the workers
 	if eventsAPIEvent.Type == goslackevents.CallbackEvent {
-		innerEvent := eventsAPIEvent.InnerEvent
-		h.Logger.Debugf("eventsAPIEvent.InnerEvent=%v", innerEvent)
-
-		metricEventsReceivedTotal.WithLabelValues(innerEvent.Type).Inc()
-
-		// Events type
-		switch ev := innerEvent.Data.(type) {
-		// AppMentionEvent
-		case *goslackevents.AppMentionEvent:
-			h.Logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
-
-			for _, action := range h.AppMentionEventActions {
-				actionned, err := action.Action(ev)
-
-				if err != nil {
-					h.Logger.Errorf("AppMentionEvent: %s", err)
-				}
-
-				if actionned {
-					metricActionPerformedTotal.WithLabelValues(fmt.Sprintf("%T", action)).Inc()
-				}
-			}
-
-		// MessageEvent
-		case *goslackevents.MessageEvent:
-			h.Logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
-
-			for _, action := range h.MessageEventActions {
-				actionned, err := action.Action(ev)
-
-				if err != nil {
-					h.Logger.Errorf("MessageEvent: %s", err)
-				}
-
-				if actionned {
-					metricActionPerformedTotal.WithLabelValues(fmt.Sprintf("%T", action)).Inc()
-				}
-			}
-
-		// SubteamUpdatedEvent
-		case *goslack.SubteamUpdatedEvent:
-			h.Logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
-
-			for _, action := range h.SubteamUpdatedEventActions {
-				actionned, err := action.Action(ev)
+		if h.Recorder != nil {
+			h.Recorder.Record(eventsAPIEvent.InnerEvent.Type, buf.Bytes())
+		}
 
-				if err != nil {
-					h.Logger.Errorf("SubteamUpdatedEvent: %s", err)
-				}
+		if callback, ok := eventsAPIEvent.Data.(*goslackevents.EventsAPICallbackEvent); ok && callback.EventTime > 0 {
+			lag := received.Sub(time.Unix(int64(callback.EventTime), 0))
+			metricEventsLagSeconds.WithLabelValues(eventsAPIEvent.InnerEvent.Type).Set(lag.Seconds())
+		}
 
-				if actionned {
-					metricActionPerformedTotal.WithLabelValues(fmt.Sprintf("%T", action)).Inc()
-				}
-			}
+		// The request context is canceled once acknowledged, only its span is kept
+		ctx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(r.Context()))
+		err := h.Pool.Submit(func() {
+			h.Dispatch(ctx, eventsAPIEvent)
+			metricEventsHandlingDuration.WithLabelValues(eventsAPIEvent.InnerEvent.Type).Observe(time.Since(received).Seconds())
+		})
 
-		default:
-			metricEventsUnhandledTotal.WithLabelValues(innerEvent.Type).Inc()
-			h.Logger.Warnf("event inner type not handled: %#v", ev)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			h.Logger.Errorf("%v", err)
+			return
 		}
 
 		return
@@ -185,3 +227,178 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// Decision is the outcome of an action run against an event
+type Decision struct {
+	Action    string
+	Actionned bool
+	Err       error
+}
+
+// Dispatch runs the actions registered for the inner event type of
+// eventsAPIEvent and returns their decisions. Actions get a logger carrying
+// the event correlation fields through ctx.
+func (h *Handler) Dispatch(ctx context.Context, eventsAPIEvent goslackevents.EventsAPIEvent) []Decision {
+	var decisions []Decision
+
+	innerEvent := eventsAPIEvent.InnerEvent
+	ctx, span := tracing.Tracer().Start(ctx, "dispatch "+innerEvent.Type, trace.WithAttributes(eventAttributes(eventsAPIEvent)...))
+	defer span.End()
+
+	fields := eventFields(eventsAPIEvent)
+	ctx = logging.WithEntry(ctx, h.Logger.WithFields(fields))
+
+	if h.Audit != nil {
+		eventID, _ := fields["event_id"].(string)
+		ctx = audit.WithLog(ctx, h.Audit, eventID)
+	}
+
+	if h.Throttler != nil {
+		ctx = throttle.WithThrottler(ctx, h.Throttler)
+	}
+
+	if h.Membership != nil {
+		ctx = membership.WithProvider(ctx, h.Membership)
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Debugf("eventsAPIEvent.InnerEvent=%v", innerEvent)
+
+	metricEventsReceivedTotal.WithLabelValues(innerEvent.Type).Inc()
+
+	// Events type
+	switch ev := innerEvent.Data.(type) {
+	// AppMentionEvent
+	case *goslackevents.AppMentionEvent:
+		logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
+		decisions = h.runActions(ctx, "AppMentionEvent", h.AppMentionEventActions, ev)
+
+	// MessageEvent
+	case *goslackevents.MessageEvent:
+		logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
+		decisions = h.runActions(ctx, "MessageEvent", h.MessageEventActions, ev)
+
+	// SubteamUpdatedEvent
+	case *goslack.SubteamUpdatedEvent:
+		logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
+		decisions = h.runActions(ctx, "SubteamUpdatedEvent", h.SubteamUpdatedEventActions, ev)
+
+	// MemberJoinedChannelEvent
+	case *goslackevents.MemberJoinedChannelEvent:
+		logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
+		decisions = h.runActions(ctx, "MemberJoinedChannelEvent", h.MemberJoinedEventActions, ev)
+
+	// ChannelCreatedEvent
+	case *goslack.ChannelCreatedEvent:
+		logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
+		decisions = h.runActions(ctx, "ChannelCreatedEvent", h.ChannelEventActions, ev)
+
+	// ChannelRenameEvent
+	case *goslack.ChannelRenameEvent:
+		logger.Debugf("eventsAPIEvent.InnerEvent.Data=%v", ev)
+		decisions = h.runActions(ctx, "ChannelRenameEvent", h.ChannelEventActions, ev)
+
+	default:
+		metricEventsUnhandledTotal.WithLabelValues(innerEvent.Type).Inc()
+		logger.Warnf("event inner type not handled: %#v", ev)
+	}
+
+	return decisions
+}
+
+// runActions runs actions against ev
+func (h *Handler) runActions(ctx context.Context, eventType string, actions []actions.Actionner, ev interface{}) []Decision {
+	var decisions []Decision
+
+	for _, action := range actions {
+		name := action.Name()
+		actionCtx, span := tracing.Tracer().Start(ctx, "action "+name, trace.WithAttributes(attribute.String("cerberus.action", name)))
+		actionCtx = logging.WithFields(actionCtx, log.Fields{"action": name})
+		actionned, err := action.Action(actionCtx, ev)
+
+		if err != nil {
+			logging.FromContext(actionCtx).Errorf("%s: %s", eventType, err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.SetAttributes(attribute.Bool("cerberus.actionned", actionned))
+		span.End()
+
+		metricActionsTotal.WithLabelValues(name, outcome(actionned, err)).Inc()
+
+		if actionned {
+			metricActionPerformedTotal.WithLabelValues(name).Inc()
+		}
+
+		decisions = append(decisions, Decision{
+			Action:    name,
+			Actionned: actionned,
+			Err:       err,
+		})
+	}
+
+	return decisions
+}
+
+// outcome returns the outcome label of an action run
+func outcome(actionned bool, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case actionned:
+		return "performed"
+	default:
+		return "skipped"
+	}
+}
+
+// eventFields returns the log fields identifying an event
+func eventFields(eventsAPIEvent goslackevents.EventsAPIEvent) log.Fields {
+	fields := log.Fields{
+		"team_id": eventsAPIEvent.TeamID,
+	}
+
+	if callback, ok := eventsAPIEvent.Data.(*goslackevents.EventsAPICallbackEvent); ok {
+		fields["event_id"] = callback.EventID
+	}
+
+	switch ev := eventsAPIEvent.InnerEvent.Data.(type) {
+	case *goslackevents.AppMentionEvent:
+		fields["channel"] = ev.Channel
+		fields["user"] = ev.User
+	case *goslackevents.MessageEvent:
+		fields["channel"] = ev.Channel
+		fields["user"] = ev.User
+	case *goslack.SubteamUpdatedEvent:
+		fields["user"] = ev.Subteam.UpdatedBy
+	case *goslackevents.MemberJoinedChannelEvent:
+		fields["channel"] = ev.Channel
+		fields["user"] = ev.User
+	case *goslack.ChannelCreatedEvent:
+		fields["channel"] = ev.Channel.ID
+		fields["user"] = ev.Channel.Creator
+	case *goslack.ChannelRenameEvent:
+		fields["channel"] = ev.Channel.ID
+	}
+
+	return fields
+}
+
+// eventAttributes returns the span attributes identifying an event
+func eventAttributes(eventsAPIEvent goslackevents.EventsAPIEvent) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String("slack.event_type", eventsAPIEvent.Type),
+		attribute.String("slack.team_id", eventsAPIEvent.TeamID),
+	}
+
+	if len(eventsAPIEvent.InnerEvent.Type) > 0 {
+		attributes = append(attributes, attribute.String("slack.inner_event_type", eventsAPIEvent.InnerEvent.Type))
+	}
+
+	if callback, ok := eventsAPIEvent.Data.(*goslackevents.EventsAPICallbackEvent); ok {
+		attributes = append(attributes, attribute.String("slack.event_id", callback.EventID))
+	}
+
+	return attributes
+}
@@ -0,0 +1,209 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/slack"
+	"github.com/sylr/cerberus/pkg/slack/fake"
+	"github.com/sylr/cerberus/pkg/tracing"
+	"github.com/sylr/cerberus/pkg/worker"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const signingSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// channelCreated is a channel_created event as recorded by the event recorder
+const channelCreated = `{"token":"XXYYZZ","team_id":"T1","api_app_id":"A1","event":{"type":"channel_created","channel":{"id":"%[1]s","name":"random-stuff","created":1600000000,"creator":"%[2]s"},"event_ts":"1600000000.000100"},"type":"event_callback","event_id":"Ev1","event_time":1600000000}`
+
+// replays counts the replayed events so that each one is about a channel and
+// a user the Slack lookup caches do not know yet
+var replays int
+
+// sign returns a request posting body signed with secret
+func sign(body, secret string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+
+	r := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(body))
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+
+	return r
+}
+
+// newHandler returns a *Handler whose Slack calls are answered by transport
+func newHandler(transport *fake.Transport, pool *worker.Pool) *Handler {
+	conf := &config.Cerberus{
+		Slack: config.Slack{Token: "xoxb-test", SigningSecret: signingSecret},
+		ChannelNaming: &config.ChannelNaming{
+			Patterns:     []string{"^team-"},
+			AdminChannel: "CADM",
+		},
+	}
+
+	slack.BaseTransport = transport
+	logger := log.New()
+
+	return NewHandler(conf, logger, slack.NewClient(&conf.Slack), pool, nil, nil, nil, nil)
+}
+
+func TestHandlerReplay(t *testing.T) {
+	defer func() { slack.BaseTransport = nil }()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := tracing.New(log.New())
+
+	if err := tracer.UseExporter(context.Background(), exporter); err != nil {
+		t.Fatal(err)
+	}
+
+	defer tracer.Shutdown(context.Background())
+
+	replays++
+	channel, user := fmt.Sprintf("C%d", replays), fmt.Sprintf("U%d", replays)
+
+	transport := fake.New(map[string]json.RawMessage{
+		"conversations.info": json.RawMessage(fmt.Sprintf(`{"ok":true,"channel":{"id":"%s","name":"random-stuff","creator":"%s"}}`, channel, user)),
+		"users.info":         json.RawMessage(fmt.Sprintf(`{"ok":true,"user":{"id":"%s","name":"jane"}}`, user)),
+	})
+	pool := worker.New(1, 1, log.New())
+	handler := newHandler(transport, pool)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, sign(fmt.Sprintf(channelCreated, channel, user), signingSecret))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Waits for the event to be processed
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+
+	for _, call := range transport.Calls() {
+		calls = append(calls, call.Method)
+	}
+
+	wantCalls := []string{"conversations.info", "users.info", "conversations.open", "chat.postMessage", "chat.postMessage"}
+
+	if strings.Join(calls, " ") != strings.Join(wantCalls, " ") {
+		t.Errorf("calls = %q, want %q", calls, wantCalls)
+	}
+
+	spans := make(map[string]map[attribute.Key]attribute.Value)
+
+	for _, span := range exporter.GetSpans() {
+		attrs := make(map[attribute.Key]attribute.Value)
+
+		for _, kv := range span.Attributes {
+			attrs[kv.Key] = kv.Value
+		}
+
+		spans[span.Name] = attrs
+	}
+
+	wantSpans := map[string]map[attribute.Key]attribute.Value{
+		"dispatch channel_created": {
+			"slack.event_type":       attribute.StringValue("event_callback"),
+			"slack.inner_event_type": attribute.StringValue("channel_created"),
+			"slack.event_id":         attribute.StringValue("Ev1"),
+			"slack.team_id":          attribute.StringValue("T1"),
+		},
+		"action channel_naming": {
+			"cerberus.action":    attribute.StringValue("channel_naming"),
+			"cerberus.actionned": attribute.BoolValue(true),
+		},
+		"slack conversations.info": {
+			"slack.method": attribute.StringValue("conversations.info"),
+		},
+	}
+
+	for name, wantAttrs := range wantSpans {
+		attrs, ok := spans[name]
+
+		if !ok {
+			t.Errorf("span %s not found", name)
+			continue
+		}
+
+		for key, want := range wantAttrs {
+			if got, ok := attrs[key]; !ok || got != want {
+				t.Errorf("span %s: attribute %s = %v, want %v", name, key, got.Emit(), want.Emit())
+			}
+		}
+	}
+}
+
+func TestHandlerRequests(t *testing.T) {
+	defer func() { slack.BaseTransport = nil }()
+
+	tests := []struct {
+		name     string
+		request  *http.Request
+		want     int
+		wantBody string
+	}{
+		{
+			name:    "invalid signature",
+			request: sign(fmt.Sprintf(channelCreated, "C0", "U0"), "not the secret"),
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "unsigned",
+			request: httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(fmt.Sprintf(channelCreated, "C0", "U0"))),
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:     "url verification",
+			request:  sign(`{"token":"XXYYZZ","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P","type":"url_verification"}`, signingSecret),
+			want:     http.StatusOK,
+			wantBody: "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := fake.New(nil)
+			pool := worker.New(1, 1, log.New())
+			handler := newHandler(transport, pool)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, test.request)
+
+			if err := pool.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if w.Code != test.want {
+				t.Errorf("status = %d, want %d", w.Code, test.want)
+			}
+
+			if len(test.wantBody) > 0 && w.Body.String() != test.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), test.wantBody)
+			}
+
+			if calls := transport.Calls(); len(calls) > 0 {
+				t.Errorf("unexpected Slack calls: %v", calls)
+			}
+		})
+	}
+}
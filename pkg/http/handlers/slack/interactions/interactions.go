@@ -0,0 +1,167 @@
+package interactions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/logging"
+	"github.com/sylr/cerberus/pkg/slack/actions"
+	"github.com/sylr/cerberus/pkg/tracing"
+	"github.com/sylr/cerberus/pkg/worker"
+
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	metricInteractionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "slack_interactions",
+			Name:      "received_total",
+			Help:      "Number of slack block actions received",
+		},
+		[]string{"action_id"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricInteractionsTotal)
+}
+
+// Handler is a http.Handler receiving the interactions with the blocks posted
+// by cerberus. Block actions are routed to the action whose name prefixes
+// their action ID.
+type Handler struct {
+	Config         *config.Cerberus
+	Logger         *log.Logger
+	Pool           *worker.Pool
+	Interactioners map[string]actions.Interactioner
+}
+
+// NewHandler ...
+func NewHandler(conf *config.Cerberus, logger *log.Logger, slackClient *goslack.Client, pool *worker.Pool) *Handler {
+	h := Handler{
+		Config:         conf,
+		Logger:         logger,
+		Pool:           pool,
+		Interactioners: make(map[string]actions.Interactioner),
+	}
+
+	for _, a := range []actions.Actionner{
+		actions.NewWelcomeMember(conf, logger, slackClient),
+	} {
+		h.Interactioners[a.Name()] = a.(actions.Interactioner)
+	}
+
+	return &h
+}
+
+// ServeHTTP ...
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(r.Body)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.Logger.Errorf("%v", err)
+		return
+	}
+
+	// Request signature, interactions are never accepted unsigned as they
+	// change usergroups
+	if len(h.Config.Slack.SigningSecret) == 0 {
+		w.WriteHeader(http.StatusForbidden)
+		h.Logger.Warnf("Interactions refused, no signing secret configured")
+		return
+	}
+
+	verifier, err := goslack.NewSecretsVerifier(r.Header, h.Config.Slack.SigningSecret)
+
+	if err == nil {
+		_, _ = verifier.Write(buf.Bytes())
+		err = verifier.Ensure()
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.Logger.Warnf("Invalid request signature: %v", err)
+		return
+	}
+
+	form, err := url.ParseQuery(buf.String())
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.Logger.Errorf("%v", err)
+		return
+	}
+
+	var callback goslack.InteractionCallback
+
+	if err := json.Unmarshal([]byte(form.Get("payload")), &callback); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.Logger.Errorf("%v", err)
+		return
+	}
+
+	if callback.Type != goslack.InteractionTypeBlockActions {
+		h.Logger.Debugf("interaction type not handled: %s", callback.Type)
+		return
+	}
+
+	// Acknowledged right away and processed by the workers
+	ctx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(r.Context()))
+	err = h.Pool.Submit(func() {
+		h.Dispatch(ctx, &callback)
+	})
+
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		h.Logger.Errorf("%v", err)
+		return
+	}
+}
+
+// Dispatch runs the interactions of the block actions of callback
+func (h *Handler) Dispatch(ctx context.Context, callback *goslack.InteractionCallback) {
+	ctx = logging.WithEntry(ctx, h.Logger.WithFields(log.Fields{
+		"team_id": callback.Team.ID,
+		"channel": callback.Channel.ID,
+		"user":    callback.User.ID,
+	}))
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		metricInteractionsTotal.WithLabelValues(action.ActionID).Inc()
+
+		name := strings.SplitN(action.ActionID, ".", 2)[0]
+		interactioner, ok := h.Interactioners[name]
+
+		if !ok {
+			logging.FromContext(ctx).Warnf("block action not handled: %s", action.ActionID)
+			continue
+		}
+
+		actionCtx, span := tracing.Tracer().Start(ctx, "interaction "+action.ActionID, trace.WithAttributes(attribute.String("cerberus.action", name)))
+		actionCtx = logging.WithFields(actionCtx, log.Fields{"action": name, "action_id": action.ActionID})
+		actionned, err := interactioner.Interact(actionCtx, callback, action)
+
+		if err != nil {
+			logging.FromContext(actionCtx).Errorf("%s: %s", action.ActionID, err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.SetAttributes(attribute.Bool("cerberus.actionned", actionned))
+		span.End()
+	}
+}
@@ -5,8 +5,18 @@ import (
 	_ "net/http/pprof"
 
 	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/audit"
+	"github.com/sylr/cerberus/pkg/health"
+	auditapi "github.com/sylr/cerberus/pkg/http/handlers/audit"
+	"github.com/sylr/cerberus/pkg/http/handlers/auth"
 	slackevents "github.com/sylr/cerberus/pkg/http/handlers/slack/events"
+	slackinteractions "github.com/sylr/cerberus/pkg/http/handlers/slack/interactions"
+	"github.com/sylr/cerberus/pkg/membership"
+	"github.com/sylr/cerberus/pkg/recorder"
 	"github.com/sylr/cerberus/pkg/slack"
+	"github.com/sylr/cerberus/pkg/throttle"
+	"github.com/sylr/cerberus/pkg/tracing"
+	"github.com/sylr/cerberus/pkg/worker"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -14,7 +24,7 @@ import (
 )
 
 // NewHTTPRouter returns an HTTP handler
-func NewHTTPRouter(conf *config.Cerberus, safe *config.Safe) http.Handler {
+func NewHTTPRouter(conf *config.Cerberus, safe *config.Safe, pool *worker.Pool, hlth *health.Health, rec *recorder.Recorder, aud *audit.Log, thr *throttle.Throttler, mem *membership.Membership) http.Handler {
 	var subrouter *mux.Router
 	var h http.Handler
 
@@ -23,18 +33,68 @@ func NewHTTPRouter(conf *config.Cerberus, safe *config.Safe) http.Handler {
 	// Slack client
 	slackClient := slack.NewClient(&conf.Slack)
 
-	// Profiling
-	subrouter = router.PathPrefix("/debug/pprof/").Subrouter()
-	subrouter.NewRoute().Handler(http.DefaultServeMux)
+	// Admin routes are served by the main listener if there is no admin listener
+	if len(conf.AdminAddress) == 0 {
+		addAdminRoutes(router, conf, aud, true)
+	}
 
-	// Metrics
-	subrouter = router.Path("/metrics").Subrouter()
-	subrouter.NewRoute().Handler(promhttp.Handler())
+	// Liveness & readiness
+	subrouter = router.Path("/healthz").Subrouter()
+	subrouter.NewRoute().Handler(hlth.HealthHandler())
+
+	subrouter = router.Path("/readyz").Subrouter()
+	subrouter.NewRoute().Handler(hlth.ReadyHandler())
 
 	// Slack events
 	subrouter = router.PathPrefix("/slack/events").Subrouter()
-	h = slackevents.NewHandler(conf, log.StandardLogger(), slackClient)
-	subrouter.NewRoute().Handler(h)
+	h = slackevents.NewHandler(conf, log.StandardLogger(), slackClient, pool, rec, aud, thr, mem)
+	subrouter.NewRoute().Handler(tracing.Handler("slack.events", h))
+
+	// Slack interactions
+	subrouter = router.PathPrefix("/slack/interactions").Subrouter()
+	h = slackinteractions.NewHandler(conf, log.StandardLogger(), slackClient, pool)
+	subrouter.NewRoute().Handler(tracing.Handler("slack.interactions", h))
+
+	return router
+}
+
+// NewAdminHTTPRouter returns an HTTP handler serving the admin routes
+func NewAdminHTTPRouter(conf *config.Cerberus, safe *config.Safe, aud *audit.Log) http.Handler {
+	router := mux.NewRouter()
+	addAdminRoutes(router, conf, aud, false)
 
 	return router
 }
+
+// addAdminRoutes adds profiling, metrics and audit routes to router. Public
+// routers, served to Slack, only get the ones requiring authentication.
+func addAdminRoutes(router *mux.Router, conf *config.Cerberus, aud *audit.Log, public bool) {
+	var subrouter *mux.Router
+	var pprofAuth, metricsAuth, auditAuth *config.HTTPAuth
+
+	if conf.Admin != nil {
+		pprofAuth = conf.Admin.Pprof
+		metricsAuth = conf.Admin.Metrics
+		auditAuth = conf.Admin.Audit
+	}
+
+	// Profiling
+	if !public || pprofAuth.Protected() {
+		subrouter = router.PathPrefix("/debug/pprof/").Subrouter()
+		subrouter.NewRoute().Handler(auth.New(http.DefaultServeMux, pprofAuth))
+	}
+
+	// Metrics
+	if !public || metricsAuth.Protected() {
+		subrouter = router.Path("/metrics").Subrouter()
+		subrouter.NewRoute().Handler(auth.New(promhttp.Handler(), metricsAuth))
+	} else {
+		log.Warnf("Metrics are not served: set admin_address or admin.metrics authentication")
+	}
+
+	// Audit log
+	if !public || auditAuth.Protected() {
+		subrouter = router.Path("/audit").Subrouter()
+		subrouter.NewRoute().Handler(auth.New(auditapi.New(aud, log.StandardLogger()), auditAuth))
+	}
+}
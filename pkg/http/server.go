@@ -0,0 +1,235 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// listenRetryDelay and listenRetries bound the wait for a previous listener
+// on the same address to be closed
+const (
+	listenRetryDelay = 50 * time.Millisecond
+	listenRetries    = 40
+)
+
+// Server is an HTTP server whose listening address and TLS settings can be
+// changed at runtime. When the address changes a new listener is started
+// before the previous one is gracefully shut down in the background.
+type Server struct {
+	handler  http.Handler
+	logger   *log.Logger
+	errors   chan error
+	server   *http.Server
+	addr     string
+	tls      *config.TLS
+	certs    *certReloader
+	draining sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewServer returns a *Server serving handler. It does not listen until Apply
+// is called.
+func NewServer(handler http.Handler, logger *log.Logger) *Server {
+	return &Server{
+		handler: handler,
+		logger:  logger,
+		errors:  make(chan error, 1),
+	}
+}
+
+// Errors returns a channel receiving the errors returned by the underlying
+// http.Server other than http.ErrServerClosed.
+func (s *Server) Errors() <-chan error {
+	return s.errors
+}
+
+// Apply makes the server listen on addr with tlsConf. An empty addr stops the
+// server. Certificates are reloaded from disk when they change so Apply does
+// not need to be called when only their content changes.
+func (s *Server) Apply(ctx context.Context, addr string, tlsConf *config.TLS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil && addr == s.addr && reflect.DeepEqual(tlsConf, s.tls) {
+		return nil
+	}
+
+	var certs *certReloader
+
+	if tlsConf != nil {
+		var err error
+		certs, err = newCertReloader(tlsConf)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	previous := s.server
+	restart := previous != nil && addr == s.addr
+
+	// Switching TLS settings on the same address, the previous listener must
+	// be closed before a new one can be bound
+	if restart {
+		s.logger.Infof("Restarting listener on %s", addr)
+		s.shutdown(ctx, previous)
+		previous = nil
+		s.server = nil
+	}
+
+	if len(addr) > 0 {
+		server, err := s.serve(addr, certs, restart)
+
+		// Falling back to the previous TLS settings so that the address is
+		// still served, addr and tls are kept so that the next Apply retries
+		if err != nil && restart {
+			fallback, ferr := s.serve(addr, s.certs, true)
+
+			if ferr != nil {
+				s.logger.Errorf("Falling back to previous TLS settings on %s: %v", addr, ferr)
+
+				select {
+				case s.errors <- ferr:
+				default:
+				}
+
+				return err
+			}
+
+			s.server = fallback
+		}
+
+		if err != nil {
+			return err
+		}
+
+		s.server = server
+	} else {
+		s.server = nil
+	}
+
+	if previous != nil {
+		s.logger.Infof("Handing over from %s to %s", s.addr, addr)
+		s.shutdown(ctx, previous)
+	}
+
+	s.addr = addr
+	s.tls = tlsConf.DeepCopy()
+	s.certs = certs
+
+	return nil
+}
+
+// serve starts serving on a new listener on addr, with TLS if certs is not
+// nil. retry is passed to listen.
+func (s *Server) serve(addr string, certs *certReloader, retry bool) (*http.Server, error) {
+	ln, err := listen(addr, retry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if certs != nil {
+		ln = tls.NewListener(ln, certs.TLSConfig())
+	}
+
+	server := &http.Server{
+		Handler:      s.handler,
+		Addr:         addr,
+		WriteTimeout: 60 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+
+	go func() {
+		err := server.Serve(ln)
+
+		if err == http.ErrServerClosed {
+			return
+		}
+
+		select {
+		case s.errors <- err:
+		default:
+			s.logger.Errorf("%v", err)
+		}
+	}()
+
+	s.logger.Infof("Listening on %s (tls=%t)", addr, certs != nil)
+
+	return server, nil
+}
+
+// Shutdown gracefully shuts down the server and waits for the previous
+// listeners still draining.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+
+	if s.server != nil {
+		err = s.server.Shutdown(ctx)
+		s.server = nil
+	}
+
+	drained := make(chan struct{})
+
+	go func() {
+		s.draining.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// shutdown gracefully shuts down server in the background so that config
+// reloads are not held for the grace period. Its listener is closed right away
+// and the deadline of ctx, but not its cancellation, bounds the drain.
+func (s *Server) shutdown(ctx context.Context, server *http.Server) {
+	drainCtx, cancel := context.Background(), context.CancelFunc(func() {})
+
+	if deadline, ok := ctx.Deadline(); ok {
+		drainCtx, cancel = context.WithDeadline(drainCtx, deadline)
+	}
+
+	s.draining.Add(1)
+
+	go func() {
+		defer s.draining.Done()
+		defer cancel()
+
+		if err := server.Shutdown(drainCtx); err != nil {
+			s.logger.Errorf("Shutting down listener %s: %v", server.Addr, err)
+		}
+	}()
+}
+
+// listen listens on addr, retrying for a while if retry is set as a previous
+// listener on the same address may still be closing.
+func listen(addr string, retry bool) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+
+	for i := 0; err != nil && retry && i < listenRetries; i++ {
+		time.Sleep(listenRetryDelay)
+		ln, err = net.Listen("tcp", addr)
+	}
+
+	return ln, err
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+)
+
+// certReloader serves the certificate and client CAs of a config.TLS and
+// reloads them from disk whenever their files are modified.
+type certReloader struct {
+	conf        *config.TLS
+	cert        *tls.Certificate
+	clientCAs   *x509.CertPool
+	certModTime time.Time
+	caModTime   time.Time
+	mu          sync.Mutex
+}
+
+func newCertReloader(conf *config.TLS) (*certReloader, error) {
+	r := certReloader{
+		conf: conf.DeepCopy(),
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// TLSConfig returns a *tls.Config which always uses the latest certificates
+// found on disk.
+func (r *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.tlsConfig()
+		},
+	}
+}
+
+func (r *certReloader) tlsConfig() (*tls.Config, error) {
+	// Keep serving the previous certificates if the new ones can not be read,
+	// e.g. when the key has not been written yet.
+	reloadErr := r.reload()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert == nil {
+		return nil, reloadErr
+	}
+
+	minVersion, _ := config.ParseTLSVersion(r.conf.MinVersion)
+	clientAuth, _ := config.ParseTLSClientAuth(r.conf.ClientAuth)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{*r.cert},
+		MinVersion:   minVersion,
+		ClientAuth:   clientAuth,
+		ClientCAs:    r.clientCAs,
+	}, nil
+}
+
+// reload reads the certificate and client CAs files if they have been
+// modified since they were last read.
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certModTime, err := modTime(r.conf.CertFile, r.conf.KeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	if r.cert == nil || certModTime.After(r.certModTime) {
+		cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+
+		if err != nil {
+			return fmt.Errorf("loading certificate: %w", err)
+		}
+
+		r.cert = &cert
+		r.certModTime = certModTime
+	}
+
+	if len(r.conf.ClientCAFile) == 0 {
+		return nil
+	}
+
+	caModTime, err := modTime(r.conf.ClientCAFile)
+
+	if err != nil {
+		return err
+	}
+
+	if r.clientCAs == nil || caModTime.After(r.caModTime) {
+		pool, err := config.LoadCertPool(r.conf.ClientCAFile)
+
+		if err != nil {
+			return err
+		}
+
+		r.clientCAs = pool
+		r.caModTime = caModTime
+	}
+
+	return nil
+}
+
+// modTime returns the latest modification time of files.
+func modTime(files ...string) (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+
+		if err != nil {
+			return latest, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
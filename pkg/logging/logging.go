@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey struct{}
+
+// WithEntry returns a copy of ctx carrying entry.
+func WithEntry(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// WithFields returns a copy of ctx carrying the entry of ctx with fields added.
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return WithEntry(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// FromContext returns the entry carried by ctx, or an entry of the standard
+// logger if there is none.
+func FromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+		return entry
+	}
+
+	return log.NewEntry(log.StandardLogger())
+}
+
+// FromContextOr returns the entry carried by ctx, or an entry of logger if
+// there is none.
+func FromContextOr(ctx context.Context, logger *log.Logger) *log.Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+		return entry
+	}
+
+	return log.NewEntry(logger)
+}
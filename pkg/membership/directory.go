@@ -0,0 +1,263 @@
+package membership
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sylr/cerberus/config"
+
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+)
+
+// NewDirectory returns a provider reading the teams from the directory export
+// file of conf, in the format of its extension unless set:
+//   - csv: a team and an email column, one row per membership
+//   - json: an object mapping teams to the emails of their members
+//   - ldif: groupOfNames entries, named by cn, whose member DNs are entries
+//     of the file having a mail
+func NewDirectory(conf *config.MembershipDirectory, client *goslack.Client, logger *log.Logger) *External {
+	parse := map[string]func(io.Reader) (map[string][]string, error){
+		"csv":  parseCSV,
+		"json": parseJSON,
+		"ldif": parseLDIF,
+	}[conf.FileFormat()]
+
+	load := func(ctx context.Context) (map[string][]string, error) {
+		f, err := os.Open(conf.File)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+
+		teams, err := parse(f)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", conf.File, err)
+		}
+
+		return teams, nil
+	}
+
+	return NewExternal("directory", load, client, logger)
+}
+
+// parseCSV parses CSV files whose header has a team (or group) and an email
+// (or mail) column
+func parseCSV(r io.Reader) (map[string][]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	teamColumn, emailColumn := -1, -1
+
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "team", "group":
+			teamColumn = i
+		case "email", "mail":
+			emailColumn = i
+		}
+	}
+
+	if teamColumn < 0 || emailColumn < 0 {
+		return nil, fmt.Errorf("header must have a team and an email column")
+	}
+
+	teams := make(map[string][]string)
+
+	for {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		team, email := record[teamColumn], record[emailColumn]
+
+		if len(team) > 0 && len(email) > 0 {
+			teams[team] = append(teams[team], email)
+		}
+	}
+
+	return teams, nil
+}
+
+// parseJSON parses JSON objects mapping teams to emails
+func parseJSON(r io.Reader) (map[string][]string, error) {
+	teams := make(map[string][]string)
+
+	if err := json.NewDecoder(r).Decode(&teams); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// parseLDIF parses the groupOfNames of LDIF files
+func parseLDIF(r io.Reader) (map[string][]string, error) {
+	entries, err := readLDIF(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return teamsFromEntries(entries, "cn", "member", "mail"), nil
+}
+
+// entry is an LDAP entry, attribute names are lowercased
+type entry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// readLDIF returns the entries of the LDIF content of r. Folded lines and
+// base64 values are supported, URL values are skipped.
+func readLDIF(r io.Reader) ([]entry, error) {
+	var entries []entry
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+
+		e := entry{attrs: make(map[string][]string)}
+
+		for _, line := range lines {
+			i := strings.Index(line, ":")
+
+			if i < 0 {
+				return fmt.Errorf("invalid line `%s`", line)
+			}
+
+			name, value := strings.ToLower(line[:i]), line[i+1:]
+
+			switch {
+			case strings.HasPrefix(value, ":"):
+				decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+
+				if err != nil {
+					return fmt.Errorf("attribute %s: %w", name, err)
+				}
+
+				value = string(decoded)
+			case strings.HasPrefix(value, "<"):
+				continue
+			default:
+				value = strings.TrimSpace(value)
+			}
+
+			if name == "dn" {
+				e.dn = value
+			} else {
+				e.attrs[name] = append(e.attrs[name], value)
+			}
+		}
+
+		if len(e.dn) > 0 {
+			entries = append(entries, e)
+		}
+
+		lines = nil
+
+		return nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case len(strings.TrimSpace(line)) == 0:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, " ") && len(lines) > 0:
+			lines[len(lines)-1] += line[1:]
+		case strings.HasPrefix(strings.ToLower(line), "version:"):
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// teamsFromEntries returns the emails of the members of the entries having
+// memberAttr, named after their groupAttr. Members are DNs of entries having a
+// mailAttr, or emails.
+func teamsFromEntries(entries []entry, groupAttr, memberAttr, mailAttr string) map[string][]string {
+	groupAttr, memberAttr, mailAttr = strings.ToLower(groupAttr), strings.ToLower(memberAttr), strings.ToLower(mailAttr)
+	mails := make(map[string]string)
+
+	for _, e := range entries {
+		if values := e.attrs[mailAttr]; len(values) > 0 {
+			mails[normalizeDN(e.dn)] = values[0]
+		}
+	}
+
+	teams := make(map[string][]string)
+
+	for _, e := range entries {
+		members, ok := e.attrs[memberAttr]
+		names := e.attrs[groupAttr]
+
+		if !ok || len(names) == 0 {
+			continue
+		}
+
+		emails := []string{}
+
+		for _, member := range members {
+			if mail, ok := mails[normalizeDN(member)]; ok {
+				emails = append(emails, mail)
+			} else if strings.Contains(member, "@") && !strings.Contains(member, "=") {
+				emails = append(emails, member)
+			}
+		}
+
+		teams[names[0]] = emails
+	}
+
+	return teams
+}
+
+// normalizeDN lowercases dn and removes the spaces around its RDNs
+func normalizeDN(dn string) string {
+	rdns := strings.Split(strings.ToLower(dn), ",")
+
+	for i := range rdns {
+		rdns[i] = strings.TrimSpace(rdns[i])
+	}
+
+	return strings.Join(rdns, ",")
+}
@@ -0,0 +1,108 @@
+package membership
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func(io.Reader) (map[string][]string, error)
+		content string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			name:  "csv",
+			parse: parseCSV,
+			content: `Email, Team, Role
+jane@example.com, sre, lead
+john@example.com, sre, member
+john@example.com, dev, member
+, dev, member
+`,
+			want: map[string][]string{
+				"sre": {"jane@example.com", "john@example.com"},
+				"dev": {"john@example.com"},
+			},
+		},
+		{
+			name:  "csv group and mail columns",
+			parse: parseCSV,
+			content: `group,mail
+sre,jane@example.com
+`,
+			want: map[string][]string{"sre": {"jane@example.com"}},
+		},
+		{
+			name:    "csv without email column",
+			parse:   parseCSV,
+			content: "team,name\nsre,Jane\n",
+			wantErr: true,
+		},
+		{
+			name:    "json",
+			parse:   parseJSON,
+			content: `{"sre": ["jane@example.com", "john@example.com"], "dev": []}`,
+			want: map[string][]string{
+				"sre": {"jane@example.com", "john@example.com"},
+				"dev": {},
+			},
+		},
+		{
+			name:    "json not an object",
+			parse:   parseJSON,
+			content: `["jane@example.com"]`,
+			wantErr: true,
+		},
+		{
+			name:  "ldif",
+			parse: parseLDIF,
+			content: `version: 1
+
+# People
+dn: uid=jane,ou=people,dc=example,dc=com
+mail: jane@example.com
+
+dn: uid=john,ou=people,dc=example,dc=com
+mail:: am9obkBleGFtcGxlLmNvbQ==
+
+dn: cn=sre,ou=groups,dc=example,dc=com
+objectClass: groupOfNames
+cn: sre
+member: uid=jane, ou=people, dc=example, dc=com
+member: UID=John,ou=people,dc=exa
+ mple,dc=com
+member: uid=nomail,ou=people,dc=example,dc=com
+member: external@example.org
+jpegPhoto:< file:///tmp/sre.jpg
+`,
+			want: map[string][]string{
+				"sre": {"jane@example.com", "john@example.com", "external@example.org"},
+			},
+		},
+		{
+			name:    "ldif invalid line",
+			parse:   parseLDIF,
+			content: "dn: cn=sre,dc=example,dc=com\ninvalid\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.parse(strings.NewReader(test.content))
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
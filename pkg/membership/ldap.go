@@ -0,0 +1,78 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+)
+
+// ldapTimeout bounds the duration of LDAP requests
+const ldapTimeout = 30 * time.Second
+
+// NewLDAP returns a provider reading the teams from the LDAP server of conf
+func NewLDAP(conf *config.MembershipLDAP, client *goslack.Client, logger *log.Logger) *External {
+	load := func(ctx context.Context) (map[string][]string, error) {
+		conn, err := ldap.DialURL(conf.URL)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer conn.Close()
+		conn.SetTimeout(ldapTimeout)
+
+		if len(conf.BindDN) > 0 {
+			if err := conn.Bind(conf.BindDN, conf.BindPassword); err != nil {
+				return nil, fmt.Errorf("bind: %w", err)
+			}
+		}
+
+		groups, err := searchLDAP(conn, conf.BaseDN, conf.GroupFilter, conf.GroupAttribute, conf.MemberAttribute)
+
+		if err != nil {
+			return nil, fmt.Errorf("groups: %w", err)
+		}
+
+		users, err := searchLDAP(conn, conf.BaseDN, fmt.Sprintf("(%s=*)", ldap.EscapeFilter(conf.MailAttribute)), conf.MailAttribute)
+
+		if err != nil {
+			return nil, fmt.Errorf("users: %w", err)
+		}
+
+		return teamsFromEntries(append(groups, users...), conf.GroupAttribute, conf.MemberAttribute, conf.MailAttribute), nil
+	}
+
+	return NewExternal("ldap", load, client, logger)
+}
+
+// searchLDAP returns the entries under base matching filter with attributes
+func searchLDAP(conn *ldap.Conn, base, filter string, attributes ...string) ([]entry, error) {
+	request := ldap.NewSearchRequest(base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout.Seconds()), false, filter, attributes, nil)
+	result, err := conn.Search(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entry, 0, len(result.Entries))
+
+	for _, e := range result.Entries {
+		converted := entry{dn: e.DN, attrs: make(map[string][]string)}
+
+		for _, attr := range e.Attributes {
+			name := strings.ToLower(attr.Name)
+			converted.attrs[name] = append(converted.attrs[name], attr.Values...)
+		}
+
+		entries = append(entries, converted)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,355 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/slack"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+)
+
+// ErrNotLoaded is returned by external providers until their first refresh
+// succeeded
+var ErrNotLoaded = errors.New("teams not loaded yet")
+
+// applyTimeout bounds the first refresh of external providers made by Apply
+const applyTimeout = time.Minute
+
+var (
+	metricRefreshesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "membership",
+			Name:      "refreshes_total",
+			Help:      "Number of refreshes of the teams of membership providers by status",
+		},
+		[]string{"provider", "status"},
+	)
+
+	metricUnmatchedMembers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "membership",
+			Name:      "unmatched_members",
+			Help:      "Number of team members without Slack user at the last refresh",
+		},
+		[]string{"provider"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricRefreshesTotal)
+	prometheus.MustRegister(metricUnmatchedMembers)
+}
+
+// MembershipProvider tells who the members of teams are
+type MembershipProvider interface {
+	// Members returns the Slack user IDs of the members of team, found being
+	// false if the provider does not know team.
+	Members(ctx context.Context, team string) (members []string, found bool, err error)
+}
+
+// Membership is the MembershipProvider shared by the event handlers and the
+// jobs. It delegates to the provider of the current config, refreshing
+// external providers in the background so that lookups only read their last
+// snapshot.
+type Membership struct {
+	logger   *log.Logger
+	provider MembershipProvider
+	stop     chan struct{}
+	mu       sync.RWMutex
+}
+
+// New returns a *Membership, lookups fail until Apply or Load is called.
+func New(logger *log.Logger) *Membership {
+	return &Membership{
+		logger: logger,
+	}
+}
+
+// Apply replaces the provider with the one configured in conf, Slack
+// usergroups if it has no membership section, and stops refreshing the
+// previous one. External providers are refreshed before replacing the previous
+// one, whose snapshot they start with if that fails.
+func (m *Membership) Apply(ctx context.Context, conf *config.Cerberus) {
+	provider, external := m.newProvider(conf)
+
+	if external != nil {
+		refreshCtx, cancel := context.WithTimeout(ctx, applyTimeout)
+		err := external.Refresh(refreshCtx)
+		cancel()
+
+		if err != nil {
+			m.logger.Errorf("%v", err)
+
+			m.mu.RLock()
+			if previous, ok := m.provider.(*External); ok {
+				external.setTeams(previous.getTeams())
+			}
+			m.mu.RUnlock()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+
+	m.provider = provider
+
+	if external != nil {
+		m.stop = make(chan struct{})
+		go external.run(conf.Membership.Refresh, m.stop)
+	}
+}
+
+// Load replaces the provider with the one configured in conf like Apply, but
+// loads external providers once right away instead of refreshing them in the
+// background. It is meant for one-shot commands.
+func (m *Membership) Load(ctx context.Context, conf *config.Cerberus) error {
+	provider, external := m.newProvider(conf)
+
+	if external != nil {
+		if err := external.Refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	m.Stop()
+
+	m.mu.Lock()
+	m.provider = provider
+	m.mu.Unlock()
+
+	return nil
+}
+
+// newProvider returns the provider configured in conf, and the same provider
+// as external one if it is
+func (m *Membership) newProvider(conf *config.Cerberus) (MembershipProvider, *External) {
+	client := slack.NewClient(&conf.Slack)
+
+	switch {
+	case conf.Membership != nil && conf.Membership.Provider == "directory":
+		external := NewDirectory(conf.Membership.Directory, client, m.logger)
+		return external, external
+	case conf.Membership != nil && conf.Membership.Provider == "ldap":
+		external := NewLDAP(conf.Membership.LDAP, client, m.logger)
+		return external, external
+	default:
+		return NewSlack(client), nil
+	}
+}
+
+// Stop stops refreshing the current provider
+func (m *Membership) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Members ...
+func (m *Membership) Members(ctx context.Context, team string) ([]string, bool, error) {
+	m.mu.RLock()
+	provider := m.provider
+	m.mu.RUnlock()
+
+	if provider == nil {
+		return nil, false, fmt.Errorf("membership: no provider")
+	}
+
+	return provider.Members(ctx, team)
+}
+
+type contextKey struct{}
+
+// WithProvider returns a copy of ctx carrying p
+func WithProvider(ctx context.Context, p MembershipProvider) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// Members calls Members on the provider carried by ctx
+func Members(ctx context.Context, team string) ([]string, bool, error) {
+	p, ok := ctx.Value(contextKey{}).(MembershipProvider)
+
+	if !ok || p == nil {
+		return nil, false, fmt.Errorf("membership: no provider")
+	}
+
+	return p.Members(ctx, team)
+}
+
+// Slack is a MembershipProvider whose teams are the usergroups of the
+// workspace, by handle.
+type Slack struct {
+	client *goslack.Client
+}
+
+// NewSlack returns a *Slack
+func NewSlack(client *goslack.Client) *Slack {
+	return &Slack{client: client}
+}
+
+// Members ...
+func (p *Slack) Members(ctx context.Context, team string) ([]string, bool, error) {
+	group, err := slack.GetUserGroup(ctx, p.client, team)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if group == nil {
+		return nil, false, nil
+	}
+
+	return group.Users, true, nil
+}
+
+// Loader returns the emails of the members of each team
+type Loader func(ctx context.Context) (map[string][]string, error)
+
+// External is a MembershipProvider whose teams are loaded from outside Slack
+// and matched to Slack users by email. Lookups read the snapshot of the last
+// successful refresh.
+type External struct {
+	name   string
+	load   Loader
+	client *goslack.Client
+	logger *log.Logger
+	teams  map[string][]string
+	mu     sync.RWMutex
+}
+
+// NewExternal returns an *External provider named name loading its teams with
+// load.
+func NewExternal(name string, load Loader, client *goslack.Client, logger *log.Logger) *External {
+	return &External{
+		name:   name,
+		load:   load,
+		client: client,
+		logger: logger,
+	}
+}
+
+// Members ...
+func (p *External) Members(ctx context.Context, team string) ([]string, bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.teams == nil {
+		return nil, false, fmt.Errorf("membership: %s: %w", p.name, ErrNotLoaded)
+	}
+
+	members, found := p.teams[team]
+
+	return members, found, nil
+}
+
+// run refreshes the teams every interval until stop is closed
+func (p *External) run(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+
+		if err := p.Refresh(ctx); err != nil {
+			p.logger.Errorf("%v", err)
+		}
+
+		cancel()
+	}
+}
+
+// Refresh loads the teams and matches their members to Slack users. The
+// previous teams are kept if it fails.
+func (p *External) Refresh(ctx context.Context) error {
+	teams, err := p.fetch(ctx)
+
+	if err != nil {
+		metricRefreshesTotal.WithLabelValues(p.name, "error").Inc()
+		return fmt.Errorf("membership: %s: %w", p.name, err)
+	}
+
+	metricRefreshesTotal.WithLabelValues(p.name, "success").Inc()
+	p.setTeams(teams)
+
+	return nil
+}
+
+// getTeams returns the current snapshot, which is never modified
+func (p *External) getTeams() map[string][]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.teams
+}
+
+// setTeams replaces the current snapshot with teams
+func (p *External) setTeams(teams map[string][]string) {
+	p.mu.Lock()
+	p.teams = teams
+	p.mu.Unlock()
+}
+
+// fetch returns the Slack user IDs of the members of each team
+func (p *External) fetch(ctx context.Context) (map[string][]string, error) {
+	emails, err := p.load(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := slack.GetUserIDsByEmail(ctx, p.client)
+
+	if err != nil {
+		return nil, err
+	}
+
+	teams := make(map[string][]string, len(emails))
+	unmatched := make(map[string]bool)
+
+	for team, members := range emails {
+		teams[team] = []string{}
+
+		for _, email := range members {
+			id, ok := ids[strings.ToLower(email)]
+
+			if !ok {
+				unmatched[email] = true
+				continue
+			}
+
+			teams[team] = append(teams[team], id)
+		}
+	}
+
+	if len(unmatched) > 0 {
+		p.logger.Debugf("membership: %s: %d members without Slack user", p.name, len(unmatched))
+	}
+
+	metricUnmatchedMembers.WithLabelValues(p.name).Set(float64(len(unmatched)))
+
+	return teams, nil
+}
@@ -0,0 +1,366 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/scheduler"
+	"github.com/sylr/cerberus/pkg/slack"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+)
+
+// maxListedMembers is the number of members listed per usergroup in reports
+const maxListedMembers = 10
+
+// maxListedLines is the number of channels or usergroups listed per section of
+// reports
+const maxListedLines = 20
+
+var (
+	metricFindings = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "team_usergroups",
+			Name:      "findings",
+			Help:      "Number of findings of the last reconciliation of team channels and usergroups by kind",
+		},
+		[]string{"kind"},
+	)
+
+	metricCreatedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "team_usergroups",
+			Name:      "created_total",
+			Help:      "Number of usergroups created for team channels",
+		},
+		[]string{"status"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricFindings)
+	prometheus.MustRegister(metricCreatedTotal)
+	scheduler.Register("team_usergroups", newJob)
+}
+
+// Outsiders are the members of the usergroup of a team channel who are not in
+// the channel
+type Outsiders struct {
+	Channel   goslack.Channel
+	UserGroup goslack.UserGroup
+	Users     []string
+}
+
+// Result is the outcome of a reconciliation
+type Result struct {
+	// Missing are the team channels without usergroup
+	Missing []goslack.Channel
+	// Mismatched are the usergroups not having their team channel as default
+	// channel
+	Mismatched []goslack.UserGroup
+	// Outsiders are the usergroups having members out of their channel
+	Outsiders []Outsiders
+	// Created are the usergroups created for the missing ones
+	Created []goslack.UserGroup
+	// Enabled are the disabled usergroups re-enabled for the missing ones
+	Enabled []goslack.UserGroup
+}
+
+// job reconciles team channels and usergroups
+type job struct {
+	conf   *config.TeamUserGroups
+	logger *log.Logger
+	client *goslack.Client
+}
+
+// newJob returns the job reconciling team channels and usergroups, findings
+// are only logged if conf has no team_usergroups section.
+func newJob(conf *config.Cerberus, logger *log.Logger) (scheduler.Job, error) {
+	j := job{
+		conf:   conf.TeamUserGroups.DeepCopy(),
+		logger: logger,
+		client: slack.NewClient(&conf.Slack),
+	}
+
+	if j.conf == nil {
+		j.conf = &config.TeamUserGroups{}
+	}
+
+	return &j, nil
+}
+
+// Run ...
+func (j *job) Run(ctx context.Context) error {
+	result, err := Run(ctx, j.client, j.conf.Create, j.logger)
+
+	if err != nil {
+		return err
+	}
+
+	if len(j.conf.Channel) == 0 {
+		return nil
+	}
+
+	var names map[string]string
+
+	if len(result.Outsiders) > 0 {
+		names, err = slack.GetUserNames(ctx, j.client)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	blocks := Build(result, names)
+
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	_, _, err = j.client.PostMessageContext(ctx, j.conf.Channel,
+		goslack.MsgOptionBlocks(blocks...),
+		goslack.MsgOptionText("Team channels and usergroups reconciliation", false),
+	)
+
+	if err != nil {
+		return fmt.Errorf("team_usergroups: %w", err)
+	}
+
+	return nil
+}
+
+// Run lists the team channels and checks that each one has a usergroup with
+// the derived handle, having the channel as default channel and no member out
+// of it. Disabled usergroups count as missing. If create is set, missing
+// usergroups are created, or re-enabled if disabled.
+func Run(ctx context.Context, client *goslack.Client, create bool, logger *log.Logger) (Result, error) {
+	var result Result
+
+	channels, err := slack.GetTeamChannels(ctx, client)
+
+	if err != nil {
+		return result, err
+	}
+
+	groups, err := client.GetUserGroupsContext(ctx,
+		goslack.GetUserGroupsOptionIncludeDisabled(true),
+		goslack.GetUserGroupsOptionIncludeUsers(true),
+	)
+
+	if err != nil {
+		return result, fmt.Errorf("team_usergroups: GetUserGroups: %w", err)
+	}
+
+	byHandle := make(map[string]goslack.UserGroup, len(groups))
+
+	for _, group := range groups {
+		byHandle[group.Handle] = group
+	}
+
+	for _, channel := range channels {
+		handle := slack.TeamUserGroupHandle(channel.Name)
+		group, found := byHandle[handle]
+
+		if !found {
+			logger.Warnf("team_usergroups: #%s has no @%s usergroup", channel.Name, handle)
+			result.Missing = append(result.Missing, channel)
+
+			if create {
+				created, err := createUserGroup(ctx, client, channel, handle)
+
+				if err != nil {
+					logger.Errorf("team_usergroups: %v", err)
+					continue
+				}
+
+				logger.Infof("team_usergroups: created @%s for #%s", handle, channel.Name)
+				result.Created = append(result.Created, created)
+			}
+
+			continue
+		}
+
+		if group.DateDelete != 0 {
+			logger.Warnf("team_usergroups: @%s of #%s is disabled", handle, channel.Name)
+			result.Missing = append(result.Missing, channel)
+
+			if create {
+				enabled, err := client.EnableUserGroupContext(ctx, group.ID)
+
+				if err != nil {
+					metricCreatedTotal.WithLabelValues("error").Inc()
+					logger.Errorf("team_usergroups: enabling @%s: %v", handle, err)
+					continue
+				}
+
+				metricCreatedTotal.WithLabelValues("success").Inc()
+				logger.Infof("team_usergroups: re-enabled @%s for #%s", handle, channel.Name)
+				result.Enabled = append(result.Enabled, enabled)
+			}
+
+			continue
+		}
+
+		if !contains(group.Prefs.Channels, channel.ID) {
+			logger.Warnf("team_usergroups: @%s does not have #%s as default channel", handle, channel.Name)
+			result.Mismatched = append(result.Mismatched, group)
+		}
+
+		members, err := slack.GetChannelMembers(ctx, client, channel.ID)
+
+		if err != nil {
+			return result, err
+		}
+
+		var outsiders []string
+
+		for _, user := range group.Users {
+			if !contains(members, user) {
+				outsiders = append(outsiders, user)
+			}
+		}
+
+		if len(outsiders) > 0 {
+			logger.Warnf("team_usergroups: %d members of @%s are not in #%s", len(outsiders), handle, channel.Name)
+			result.Outsiders = append(result.Outsiders, Outsiders{Channel: channel, UserGroup: group, Users: outsiders})
+		}
+	}
+
+	if len(result.Created) > 0 || len(result.Enabled) > 0 {
+		slack.InvalidateGroupCache("")
+	}
+
+	metricFindings.WithLabelValues("missing").Set(float64(len(result.Missing) - len(result.Created) - len(result.Enabled)))
+	metricFindings.WithLabelValues("mismatched").Set(float64(len(result.Mismatched)))
+	metricFindings.WithLabelValues("outsiders").Set(float64(len(result.Outsiders)))
+
+	return result, nil
+}
+
+// createUserGroup creates the usergroup handle with channel as default channel
+func createUserGroup(ctx context.Context, client *goslack.Client, channel goslack.Channel, handle string) (goslack.UserGroup, error) {
+	group, err := client.CreateUserGroupContext(ctx, goslack.UserGroup{
+		Name:        channel.Name,
+		Handle:      handle,
+		Description: fmt.Sprintf("Members of #%s", channel.Name),
+		Prefs:       goslack.UserGroupPrefs{Channels: []string{channel.ID}},
+	})
+
+	if err != nil {
+		metricCreatedTotal.WithLabelValues("error").Inc()
+		return group, fmt.Errorf("creating @%s: %w", handle, err)
+	}
+
+	metricCreatedTotal.WithLabelValues("success").Inc()
+
+	return group, nil
+}
+
+// Build returns the Block Kit blocks reporting result, none if there is
+// nothing to report. Usergroups are named by handle and users after names, by
+// ID, so that they are not notified.
+func Build(result Result, names map[string]string) []goslack.Block {
+	var sections [][]string
+
+	// Team channels without usergroup
+	if len(result.Missing) > 0 {
+		var lines []string
+
+		for _, channel := range result.Missing {
+			handle := slack.TeamUserGroupHandle(channel.Name)
+			line := fmt.Sprintf("<#%s> (expected @%s)", channel.ID, handle)
+
+			for _, group := range result.Created {
+				if group.Handle == handle {
+					line = fmt.Sprintf("<#%s>: created @%s", channel.ID, handle)
+				}
+			}
+
+			for _, group := range result.Enabled {
+				if group.Handle == handle {
+					line = fmt.Sprintf("<#%s>: re-enabled @%s", channel.ID, handle)
+				}
+			}
+
+			lines = append(lines, line)
+		}
+
+		sections = append(sections, append([]string{"*Team channels without a matching usergroup*"}, slack.CapLines(lines, maxListedLines)...))
+	}
+
+	// Usergroups without their channel as default channel
+	if len(result.Mismatched) > 0 {
+		var lines []string
+
+		for _, group := range result.Mismatched {
+			lines = append(lines, "@"+group.Handle)
+		}
+
+		sections = append(sections, append([]string{"*Usergroups without their team channel as default channel*"}, slack.CapLines(lines, maxListedLines)...))
+	}
+
+	// Members out of the channel
+	if len(result.Outsiders) > 0 {
+		var lines []string
+
+		for _, o := range result.Outsiders {
+			users := o.Users
+			more := ""
+
+			if len(users) > maxListedMembers {
+				more = fmt.Sprintf(" and %d more", len(users)-maxListedMembers)
+				users = users[:maxListedMembers]
+			}
+
+			named := make([]string, 0, len(users))
+
+			for _, user := range users {
+				if name, ok := names[user]; ok {
+					named = append(named, "@"+name)
+				} else {
+					named = append(named, user)
+				}
+			}
+
+			lines = append(lines, fmt.Sprintf("@%s in <#%s>: %s%s", o.UserGroup.Handle, o.Channel.ID, strings.Join(named, ", "), more))
+		}
+
+		sections = append(sections, append([]string{"*Usergroup members who are not in the team channel*"}, slack.CapLines(lines, maxListedLines)...))
+	}
+
+	if len(sections) == 0 {
+		return nil
+	}
+
+	title := "Team channels and usergroups reconciliation"
+	blocks := []goslack.Block{
+		goslack.NewHeaderBlock(goslack.NewTextBlockObject(goslack.PlainTextType, title, false, false)),
+	}
+
+	for i, lines := range sections {
+		if i > 0 {
+			blocks = append(blocks, goslack.NewDividerBlock())
+		}
+
+		blocks = append(blocks, slack.MarkdownSections(lines)...)
+	}
+
+	return blocks
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
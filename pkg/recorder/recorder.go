@@ -0,0 +1,277 @@
+package recorder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	filePrefix = "events-"
+	fileSuffix = ".jsonl"
+)
+
+var (
+	metricRecorderEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "recorder",
+			Name:      "events_total",
+			Help:      "Number of slack events written by the event recorder",
+		},
+		[]string{"type"},
+	)
+
+	// userKeys are the event keys holding user IDs
+	userKeys = map[string]bool{
+		"user":         true,
+		"user_id":      true,
+		"users":        true,
+		"creator":      true,
+		"inviter":      true,
+		"authed_users": true,
+	}
+
+	// textKeys are the event keys holding message content
+	textKeys = map[string]bool{
+		"text":        true,
+		"blocks":      true,
+		"attachments": true,
+		"files":       true,
+	}
+)
+
+func init() {
+	prometheus.MustRegister(metricRecorderEventsTotal)
+}
+
+// Recorder appends received Events API envelopes to rotating JSONL files which
+// can later be fed to `cerberus replay`.
+type Recorder struct {
+	logger *log.Logger
+	conf   *config.EventRecorder
+	file   *os.File
+	size   int64
+	mu     sync.Mutex
+}
+
+// New returns a *Recorder, it does not record anything until Apply is called
+// with a non nil config.
+func New(logger *log.Logger) *Recorder {
+	return &Recorder{
+		logger: logger,
+	}
+}
+
+// Apply replaces the recorder config, a nil config disables recording.
+func (r *Recorder) Apply(conf *config.EventRecorder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if conf != nil {
+		if err := os.MkdirAll(conf.Directory, 0750); err != nil {
+			return fmt.Errorf("recorder: %w", err)
+		}
+	}
+
+	if r.conf == nil || conf == nil || r.conf.Directory != conf.Directory {
+		r.closeFile()
+	}
+
+	r.conf = conf.DeepCopy()
+
+	return nil
+}
+
+// Record writes the envelope of an event of type eventType if it matches the
+// filters and is sampled.
+func (r *Recorder) Record(eventType string, envelope []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conf == nil || !r.selected(eventType) {
+		return
+	}
+
+	line, err := r.redact(envelope)
+
+	if err != nil {
+		r.logger.Errorf("recorder: %v", err)
+		return
+	}
+
+	if err := r.write(append(line, '\n')); err != nil {
+		r.logger.Errorf("recorder: %v", err)
+		return
+	}
+
+	metricRecorderEventsTotal.WithLabelValues(eventType).Inc()
+}
+
+// Close closes the current file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.closeFile()
+}
+
+// selected reports whether an event of type eventType must be recorded.
+func (r *Recorder) selected(eventType string) bool {
+	if len(r.conf.EventTypes) > 0 {
+		found := false
+
+		for _, t := range r.conf.EventTypes {
+			if t == eventType {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return r.conf.SampleRate >= 1 || rand.Float64() < r.conf.SampleRate
+}
+
+// redact drops the verification token of the envelope, blanks message content
+// and pseudonymizes user IDs according to the config.
+func (r *Recorder) redact(envelope []byte) ([]byte, error) {
+	var decoded map[string]interface{}
+
+	if err := json.Unmarshal(envelope, &decoded); err != nil {
+		return nil, err
+	}
+
+	delete(decoded, "token")
+
+	for key, value := range decoded {
+		decoded[key] = r.redactValue(key, value)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(decoded); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func (r *Recorder) redactValue(key string, value interface{}) interface{} {
+	if r.conf.Redact.Text && textKeys[key] {
+		if _, ok := value.(string); ok {
+			return "<redacted>"
+		}
+
+		return nil
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = r.redactValue(k, elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = r.redactValue(key, elem)
+		}
+	case string:
+		if r.conf.Redact.Users && userKeys[key] {
+			return pseudonymize(v)
+		}
+	}
+
+	return value
+}
+
+// write appends line to the current file, rotating it if it is full.
+func (r *Recorder) write(line []byte) error {
+	if r.file != nil && r.size+int64(len(line)) > r.conf.MaxFileSize {
+		r.closeFile()
+	}
+
+	if r.file == nil {
+		if err := r.openFile(); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+
+	return err
+}
+
+func (r *Recorder) openFile() error {
+	name := filepath.Join(r.conf.Directory, filePrefix+time.Now().UTC().Format("20060102T150405.000000000")+fileSuffix)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+
+	if err != nil {
+		return err
+	}
+
+	r.file = file
+	r.size = 0
+	r.removeOldFiles()
+
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+// removeOldFiles keeps the r.conf.MaxFiles most recent files.
+func (r *Recorder) removeOldFiles() {
+	files, err := filepath.Glob(filepath.Join(r.conf.Directory, filePrefix+"*"+fileSuffix))
+
+	if err != nil || len(files) <= r.conf.MaxFiles {
+		return
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files[:len(files)-r.conf.MaxFiles] {
+		if err := os.Remove(file); err != nil {
+			r.logger.Errorf("recorder: %v", err)
+		}
+	}
+}
+
+// pseudonymize replaces a user ID by a stable fake one so that events of the
+// same user can still be correlated.
+func pseudonymize(user string) string {
+	if len(user) == 0 {
+		return user
+	}
+
+	sum := sha256.Sum256([]byte(user))
+
+	return "U" + strings.ToUpper(hex.EncodeToString(sum[:5]))
+}
@@ -0,0 +1,196 @@
+package recorder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylr/cerberus/config"
+
+	log "github.com/sirupsen/logrus"
+	goslackevents "github.com/slack-go/slack/slackevents"
+)
+
+const appMention = `{"token":"XXYYZZ","team_id":"T1","event":{"type":"app_mention","user":"U1","text":"<@U0> help","channel":"C1","ts":"1600000000.000100","blocks":[{"type":"rich_text"}]},"type":"event_callback","event_id":"Ev1","authed_users":["U0"]}`
+
+// recorded returns the lines of the files recorded in dir, oldest first
+func recorded(t *testing.T, dir string) [][]string {
+	files, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"+fileSuffix))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines [][]string
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"))
+	}
+
+	return lines
+}
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		conf      config.EventRecorder
+		eventType string
+		want      bool
+		check     func(t *testing.T, event map[string]interface{})
+	}{
+		{
+			name:      "verbatim",
+			conf:      config.EventRecorder{SampleRate: 1},
+			eventType: "app_mention",
+			want:      true,
+			check: func(t *testing.T, event map[string]interface{}) {
+				if event["user"] != "U1" || event["text"] != "<@U0> help" || event["blocks"] == nil {
+					t.Errorf("event = %v, want it untouched", event)
+				}
+			},
+		},
+		{
+			name:      "redacted",
+			conf:      config.EventRecorder{SampleRate: 1, Redact: config.EventRecorderRedact{Text: true, Users: true}},
+			eventType: "app_mention",
+			want:      true,
+			check: func(t *testing.T, event map[string]interface{}) {
+				if event["user"] != pseudonymize("U1") {
+					t.Errorf("user = %v, want %s", event["user"], pseudonymize("U1"))
+				}
+
+				if event["text"] != "<redacted>" || event["blocks"] != nil {
+					t.Errorf("text = %v, blocks = %v, want them redacted", event["text"], event["blocks"])
+				}
+			},
+		},
+		{
+			name:      "selected type",
+			conf:      config.EventRecorder{SampleRate: 1, EventTypes: []string{"message", "app_mention"}},
+			eventType: "app_mention",
+			want:      true,
+		},
+		{
+			name:      "filtered type",
+			conf:      config.EventRecorder{SampleRate: 1, EventTypes: []string{"message"}},
+			eventType: "app_mention",
+		},
+		{
+			name:      "not sampled",
+			conf:      config.EventRecorder{SampleRate: 0},
+			eventType: "app_mention",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "recorder")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer os.RemoveAll(dir)
+
+			conf := test.conf
+			conf.Directory = dir
+			conf.MaxFileSize = 1 << 20
+			conf.MaxFiles = 1
+
+			r := New(log.New())
+
+			if err := r.Apply(&conf); err != nil {
+				t.Fatal(err)
+			}
+
+			r.Record(test.eventType, []byte(appMention))
+			r.Close()
+
+			files := recorded(t, dir)
+
+			if !test.want {
+				if len(files) != 0 {
+					t.Errorf("got %d files, want none", len(files))
+				}
+				return
+			}
+
+			if len(files) != 1 || len(files[0]) != 1 {
+				t.Fatalf("got %v, want a file of one line", files)
+			}
+
+			line := files[0][0]
+
+			// Recorded events can be replayed
+			if _, err := goslackevents.ParseEvent(json.RawMessage(line), goslackevents.OptionNoVerifyToken()); err != nil {
+				t.Errorf("ParseEvent() error = %v", err)
+			}
+
+			var envelope struct {
+				Token string                 `json:"token"`
+				Event map[string]interface{} `json:"event"`
+			}
+
+			if err := json.Unmarshal([]byte(line), &envelope); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(envelope.Token) > 0 {
+				t.Errorf("token recorded")
+			}
+
+			if test.check != nil {
+				test.check(t, envelope.Event)
+			}
+		})
+	}
+}
+
+func TestRecordRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	r := New(log.New())
+	conf := &config.EventRecorder{
+		Directory:   dir,
+		SampleRate:  1,
+		MaxFileSize: int64(len(appMention)) * 2,
+		MaxFiles:    2,
+	}
+
+	if err := r.Apply(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		r.Record("app_mention", []byte(appMention))
+	}
+
+	r.Close()
+
+	// Lines are a bit shorter than the envelope as the token is dropped: two
+	// per file, the oldest file being removed
+	files := recorded(t, dir)
+
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	if len(files[0]) != 2 || len(files[1]) != 1 {
+		t.Errorf("got files of %d and %d lines, want 2 and 1", len(files[0]), len(files[1]))
+	}
+}
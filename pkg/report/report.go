@@ -0,0 +1,288 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/audit"
+	"github.com/sylr/cerberus/pkg/scheduler"
+	"github.com/sylr/cerberus/pkg/slack"
+	"github.com/sylr/cerberus/pkg/slack/actions"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+)
+
+const week = 7 * 24 * time.Hour
+
+// maxListedChannels is the number of channels listed per section of the report
+const maxListedChannels = 20
+
+var (
+	metricReportsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "report",
+			Name:      "posted_total",
+			Help:      "Number of weekly reports posted",
+		},
+		[]string{"status"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricReportsTotal)
+	scheduler.Register("weekly_report", newJob)
+}
+
+// job posts the weekly report
+type job struct {
+	conf   *config.Report
+	audit  *audit.Log
+	client *goslack.Client
+}
+
+// newJob returns the job posting the weekly report configured by conf
+func newJob(conf *config.Cerberus, logger *log.Logger) (scheduler.Job, error) {
+	if conf.Report == nil {
+		return nil, fmt.Errorf("report: no report configured")
+	}
+
+	aud := audit.New(logger)
+
+	if err := aud.Apply(conf.Audit); err != nil {
+		return nil, err
+	}
+
+	j := job{
+		conf:   conf.Report.DeepCopy(),
+		audit:  aud,
+		client: slack.NewClient(&conf.Slack),
+	}
+
+	return &j, nil
+}
+
+// Run ...
+func (j *job) Run(ctx context.Context) error {
+	return Run(ctx, j.audit, j.conf, j.client)
+}
+
+// Run builds the report of the last 7 days from aud and posts it.
+func Run(ctx context.Context, aud *audit.Log, conf *config.Report, client *goslack.Client) error {
+	now := time.Now().UTC()
+
+	current, err := aud.Query(audit.Filter{Since: now.Add(-week), Until: now})
+
+	if err != nil {
+		metricReportsTotal.WithLabelValues("error").Inc()
+		return err
+	}
+
+	previous, err := aud.Query(audit.Filter{Since: now.Add(-2 * week), Until: now.Add(-week)})
+
+	if err != nil {
+		metricReportsTotal.WithLabelValues("error").Inc()
+		return err
+	}
+
+	missing, err := channelsWithoutUserGroup(ctx, client)
+
+	if err != nil {
+		metricReportsTotal.WithLabelValues("error").Inc()
+		return err
+	}
+
+	var names map[string]string
+
+	if !conf.Anonymize {
+		names, err = slack.GetUserNames(ctx, client)
+
+		if err != nil {
+			metricReportsTotal.WithLabelValues("error").Inc()
+			return err
+		}
+	}
+
+	blocks := Build(now, current, previous, missing, names, conf)
+	_, _, err = client.PostMessageContext(ctx, conf.Channel,
+		goslack.MsgOptionBlocks(blocks...),
+		goslack.MsgOptionText("Cerberus weekly report", false),
+	)
+
+	if err != nil {
+		metricReportsTotal.WithLabelValues("error").Inc()
+		return fmt.Errorf("report: %w", err)
+	}
+
+	metricReportsTotal.WithLabelValues("success").Inc()
+
+	return nil
+}
+
+// channelsWithoutUserGroup returns the team channels lacking a matching usergroup
+func channelsWithoutUserGroup(ctx context.Context, client *goslack.Client) ([]goslack.Channel, error) {
+	var missing []goslack.Channel
+
+	channels, err := slack.GetTeamChannels(ctx, client)
+
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := slack.GetUserGroups(ctx, client)
+
+	if err != nil {
+		return nil, err
+	}
+
+	handles := make(map[string]bool, len(groups))
+
+	for _, group := range groups {
+		handles[group.Handle] = true
+	}
+
+	for _, channel := range channels {
+		if !handles[slack.TeamUserGroupHandle(channel.Name)] {
+			missing = append(missing, channel)
+		}
+	}
+
+	return missing, nil
+}
+
+// count is a number of violations of a channel or a user
+type count struct {
+	ID    string
+	Count int
+}
+
+// violations returns the total of broadcast violations and their breakdown by
+// channel and by user, both sorted by decreasing count.
+func violations(entries []audit.Entry) (int, []count, []count) {
+	total := 0
+	channels := make(map[string]int)
+	users := make(map[string]int)
+
+	for _, entry := range entries {
+		if entry.Rule != actions.RuleTeamChannelAtChannel {
+			continue
+		}
+
+		total++
+		channels[entry.Channel]++
+		users[entry.User]++
+	}
+
+	return total, sortCounts(channels), sortCounts(users)
+}
+
+// sortCounts returns counts sorted by decreasing count then by ID
+func sortCounts(counts map[string]int) []count {
+	sorted := make([]count, 0, len(counts))
+
+	for id, c := range counts {
+		sorted = append(sorted, count{ID: id, Count: c})
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	return sorted
+}
+
+// trend describes the evolution from previous to current
+func trend(current, previous int) string {
+	switch {
+	case previous == 0 && current == 0:
+		return "no change"
+	case previous == 0:
+		return fmt.Sprintf("+%d vs previous week", current)
+	}
+
+	diff := current - previous
+	percent := diff * 100 / previous
+
+	if diff >= 0 {
+		return fmt.Sprintf("+%d (+%d%%) vs previous week", diff, percent)
+	}
+
+	return fmt.Sprintf("%d (%d%%) vs previous week", diff, percent)
+}
+
+// Build returns the Block Kit blocks of the report ending at now. Offenders
+// are named after names, by user ID, so that they are not notified.
+func Build(now time.Time, current, previous []audit.Entry, missing []goslack.Channel, names map[string]string, conf *config.Report) []goslack.Block {
+	total, channels, users := violations(current)
+	previousTotal, _, _ := violations(previous)
+
+	title := fmt.Sprintf("Cerberus weekly report %s - %s", now.Add(-week).Format("Jan 2"), now.Format("Jan 2"))
+	blocks := []goslack.Block{
+		goslack.NewHeaderBlock(goslack.NewTextBlockObject(goslack.PlainTextType, title, false, false)),
+	}
+	blocks = append(blocks, slack.MarkdownSections([]string{fmt.Sprintf("*Broadcast violations:* %d (%s)", total, trend(total, previousTotal))})...)
+
+	// Violations per channel
+	if len(channels) > 0 {
+		lines := []string{}
+
+		for _, c := range channels {
+			lines = append(lines, fmt.Sprintf("<#%s>: %d", c.ID, c.Count))
+		}
+
+		lines = append([]string{"*Violations per channel*"}, slack.CapLines(lines, maxListedChannels)...)
+		blocks = append(blocks, goslack.NewDividerBlock())
+		blocks = append(blocks, slack.MarkdownSections(lines)...)
+	}
+
+	// Top offenders
+	if len(users) > 0 {
+		lines := []string{"*Top offenders*"}
+
+		for i, c := range users {
+			if i >= conf.TopOffenders {
+				break
+			}
+
+			if conf.Anonymize {
+				lines = append(lines, fmt.Sprintf("%d. Offender %d: %d", i+1, i+1, c.Count))
+				continue
+			}
+
+			name := c.ID
+
+			if n, ok := names[c.ID]; ok {
+				name = "@" + n
+			}
+
+			lines = append(lines, fmt.Sprintf("%d. %s: %d", i+1, name, c.Count))
+		}
+
+		blocks = append(blocks, goslack.NewDividerBlock())
+		blocks = append(blocks, slack.MarkdownSections(lines)...)
+	}
+
+	// Channels lacking a usergroup
+	if len(missing) > 0 {
+		lines := []string{}
+
+		for _, channel := range missing {
+			lines = append(lines, fmt.Sprintf("<#%s> (expected @%s)", channel.ID, slack.TeamUserGroupHandle(channel.Name)))
+		}
+
+		lines = append([]string{"*Team channels without a matching usergroup*"}, slack.CapLines(lines, maxListedChannels)...)
+		blocks = append(blocks, goslack.NewDividerBlock())
+		blocks = append(blocks, slack.MarkdownSections(lines)...)
+	}
+
+	return blocks
+}
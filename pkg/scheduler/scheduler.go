@@ -0,0 +1,313 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/state"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+const lastRunKeyPrefix = "scheduler.last_run."
+
+var (
+	metricJobRunsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "scheduler",
+			Name:      "runs_total",
+			Help:      "Number of job runs by status (success, error or skipped)",
+		},
+		[]string{"job", "status"},
+	)
+
+	metricJobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cerberus",
+			Subsystem: "scheduler",
+			Name:      "run_duration_seconds",
+			Help:      "Duration of job runs",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"job"},
+	)
+
+	metricJobLastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "scheduler",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Time of the last successful run of jobs",
+		},
+		[]string{"job"},
+	)
+
+	// factories are the job factories by action
+	factories = make(map[string]Factory)
+)
+
+func init() {
+	prometheus.MustRegister(metricJobRunsTotal)
+	prometheus.MustRegister(metricJobDuration)
+	prometheus.MustRegister(metricJobLastSuccess)
+}
+
+// Job is an action run by the scheduler
+type Job interface {
+	Run(ctx context.Context) error
+}
+
+// Factory returns the Job running an action with conf
+type Factory func(conf *config.Cerberus, logger *log.Logger) (Job, error)
+
+// Register declares factory as the way to run action as a job. It must be
+// called from init functions.
+func Register(action string, factory Factory) {
+	factories[action] = factory
+	config.RegisterJobAction(action)
+}
+
+// Scheduler runs jobs according to their cron schedule. The last run of each
+// job is persisted in the state store so missed runs can be caught up at
+// startup, and a job is never run twice concurrently, even across reloads.
+type Scheduler struct {
+	logger   *log.Logger
+	store    *state.Store
+	cron     *cron.Cron
+	started  bool
+	stopped  bool
+	running  map[string]bool
+	runs     map[string]func()
+	ctx      context.Context
+	inFlight sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// New returns a *Scheduler, nothing is scheduled until Apply is called.
+func New(logger *log.Logger, store *state.Store) *Scheduler {
+	return &Scheduler{
+		logger:  logger,
+		store:   store,
+		running: make(map[string]bool),
+		ctx:     context.Background(),
+	}
+}
+
+// SetContext sets the context jobs are run with, carrying the components they
+// share with the event handlers such as the membership provider.
+func (s *Scheduler) SetContext(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ctx = ctx
+}
+
+// Jobs returns the jobs of conf, including the weekly report and the usergroups
+// sync if it has report and usergroups sections.
+func Jobs(conf *config.Cerberus) []config.Job {
+	var jobs []config.Job
+
+	if conf.Report != nil {
+		jobs = append(jobs, config.Job{
+			Name:     "weekly_report",
+			Schedule: conf.Report.Schedule,
+			Action:   "weekly_report",
+		})
+	}
+
+	if conf.UserGroups != nil {
+		jobs = append(jobs, config.Job{
+			Name:     "usergroups_sync",
+			Schedule: conf.UserGroups.Schedule,
+			Action:   "usergroups_sync",
+		})
+	}
+
+	if conf.Scheduler != nil {
+		jobs = append(jobs, conf.Scheduler.Jobs...)
+	}
+
+	return jobs
+}
+
+// Apply replaces the scheduled jobs with the ones of conf. On the first call,
+// the jobs which missed a run and have catch up enabled are run right away.
+func (s *Scheduler) Apply(conf *config.Cerberus) error {
+	c := cron.New()
+	runs := make(map[string]func())
+	var catchUp []func()
+
+	for _, job := range Jobs(conf) {
+		factory, ok := factories[job.Action]
+
+		if !ok {
+			return fmt.Errorf("scheduler: job %s: unknown action `%s`", job.Name, job.Action)
+		}
+
+		runner, err := factory(conf, s.logger)
+
+		if err != nil {
+			return fmt.Errorf("scheduler: job %s: %w", job.Name, err)
+		}
+
+		name := job.Name
+		run := func() { s.run(name, runner) }
+		runs[name] = run
+		id, err := c.AddFunc(job.Spec(), run)
+
+		if err != nil {
+			return fmt.Errorf("scheduler: job %s: %w", job.Name, err)
+		}
+
+		if job.CatchUp && s.missed(name, c.Entry(id).Schedule) {
+			catchUp = append(catchUp, run)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cron != nil {
+		s.cron.Stop()
+	}
+
+	s.cron = c
+	s.cron.Start()
+	s.runs = runs
+
+	if !s.started {
+		s.started = true
+
+		for _, run := range catchUp {
+			go run()
+		}
+	}
+
+	return nil
+}
+
+// Trigger runs the job name in the background, outside of its schedule.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	run, ok := s.runs[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("scheduler: unknown job %s", name)
+	}
+
+	go run()
+
+	return nil
+}
+
+// Stop cancels the schedules and waits for the running jobs, scheduled,
+// triggered or caught up, until ctx is done. No job is run afterwards.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	c := s.cron
+	s.cron = nil
+	s.stopped = true
+	s.mu.Unlock()
+
+	if c != nil {
+		c.Stop()
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler: %w", ctx.Err())
+	}
+}
+
+// missed reports whether the job name missed a run since its last run
+func (s *Scheduler) missed(name string, schedule cron.Schedule) bool {
+	var lastRun time.Time
+
+	found, err := s.store.Get(lastRunKeyPrefix+name, &lastRun)
+
+	if err != nil {
+		s.logger.Errorf("scheduler: job %s: %v", name, err)
+		return false
+	}
+
+	return found && schedule.Next(lastRun).Before(time.Now())
+}
+
+// run runs job unless a previous run is still in progress or the scheduler is
+// stopped
+func (s *Scheduler) run(name string, job Job) {
+	s.mu.Lock()
+
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+
+	if s.running[name] {
+		s.mu.Unlock()
+		s.logger.Warnf("scheduler: job %s: skipped, previous run still in progress", name)
+		metricJobRunsTotal.WithLabelValues(name, "skipped").Inc()
+		return
+	}
+
+	s.running[name] = true
+	s.inFlight.Add(1)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, name)
+		s.mu.Unlock()
+		s.inFlight.Done()
+	}()
+
+	s.logger.Infof("scheduler: job %s: running", name)
+
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	start := time.Now()
+	err := safeRun(ctx, job)
+	metricJobDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+	if err := s.store.Set(lastRunKeyPrefix+name, start); err != nil {
+		s.logger.Errorf("scheduler: job %s: %v", name, err)
+	}
+
+	if err != nil {
+		s.logger.Errorf("scheduler: job %s: %v", name, err)
+		metricJobRunsTotal.WithLabelValues(name, "error").Inc()
+		return
+	}
+
+	metricJobRunsTotal.WithLabelValues(name, "success").Inc()
+	metricJobLastSuccess.WithLabelValues(name).Set(float64(time.Now().Unix()))
+}
+
+// safeRun runs job and turns its panics into errors
+func safeRun(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered from panic: %v", r)
+		}
+	}()
+
+	return job.Run(ctx)
+}
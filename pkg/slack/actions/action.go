@@ -1,6 +1,21 @@
 package actions
 
+import (
+	"context"
+
+	goslack "github.com/slack-go/slack"
+)
+
 // Actionner
 type Actionner interface {
-	Action(interface{}) (actionned bool, err error)
+	// Name returns a stable identifier of the action used in metrics and logs
+	Name() string
+	Action(ctx context.Context, event interface{}) (actionned bool, err error)
+}
+
+// Interactioner is an action posting interactive blocks. It handles the block
+// actions whose action ID is prefixed by its name and a dot.
+type Interactioner interface {
+	Actionner
+	Interact(ctx context.Context, callback *goslack.InteractionCallback, action *goslack.BlockAction) (actionned bool, err error)
 }
@@ -0,0 +1,178 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sylr/cerberus/pkg/slack"
+
+	goslackevents "github.com/slack-go/slack/slackevents"
+)
+
+var (
+	userMentionRegexp = regexp.MustCompile(`^<@[UW][A-Z0-9]+(\|[^>]*)?>$`)
+	channelRefRegexp  = regexp.MustCompile(`^<#([CG][A-Z0-9]+)(?:\|([^>]*))?>$`)
+	subteamRefRegexp  = regexp.MustCompile(`^<!subteam\^([A-Z0-9]+)(?:\|@?([^>]*))?>$`)
+)
+
+// Command is a subcommand of a @cerberus mention
+type Command struct {
+	Name string
+	Args []string
+}
+
+// commandHandler returns the reply to a command
+type commandHandler func(ctx context.Context, a *CerberusMention, ev *goslackevents.AppMentionEvent, args []string) (string, error)
+
+// command describes a subcommand
+type command struct {
+	words   []string
+	usage   string
+	help    string
+	handler commandHandler
+}
+
+// commands are the subcommands understood by @cerberus, initialized in init to
+// break the reference cycle with the help handler
+var commands []command
+
+func init() {
+	commands = []command{
+		{words: []string{"help"}, usage: "help", help: "show this message", handler: helpCommand},
+		{words: []string{"policy"}, usage: "policy", help: "explain the @channel policy of team channels", handler: policyCommand},
+		{words: []string{"who", "owns"}, usage: "who owns #channel", help: "show the usergroup owning a team channel", handler: whoOwnsCommand},
+		{words: []string{"ping"}, usage: "ping @usergroup", help: "ping the members of a usergroup in this thread", handler: pingCommand},
+	}
+}
+
+// ParseCommand returns the command of the text of an app mention. Mentions of
+// users, i.e. of cerberus itself, are ignored. It returns false if no known
+// command is found.
+func ParseCommand(text string) (Command, bool) {
+	var words []string
+
+	for _, word := range strings.Fields(text) {
+		if !userMentionRegexp.MatchString(word) {
+			words = append(words, word)
+		}
+	}
+
+	for _, c := range commands {
+		if len(words) < len(c.words) {
+			continue
+		}
+
+		matched := true
+
+		for i, word := range c.words {
+			if !strings.EqualFold(words[i], word) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return Command{Name: strings.Join(c.words, " "), Args: words[len(c.words):]}, true
+		}
+	}
+
+	return Command{}, false
+}
+
+// lookupCommand returns the handler of the command named name
+func lookupCommand(name string) commandHandler {
+	for _, c := range commands {
+		if strings.Join(c.words, " ") == name {
+			return c.handler
+		}
+	}
+
+	return nil
+}
+
+// helpCommand lists the commands
+func helpCommand(ctx context.Context, a *CerberusMention, ev *goslackevents.AppMentionEvent, args []string) (string, error) {
+	lines := []string{"Here is what I understand:"}
+
+	for _, c := range commands {
+		lines = append(lines, fmt.Sprintf("• `@cerberus %s`: %s", c.usage, c.help))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// policy is the @channel etiquette of team channels
+const policy = "In team channels (`#team-*`), only the members of the matching usergroup " +
+	"(`@teamfoo` for `#team-foo`), the channel creator and workspace admins may mention @channel. " +
+	"Everyone else should mention the usergroup to get the team's attention."
+
+// policyCommand explains the team channels policy
+func policyCommand(ctx context.Context, a *CerberusMention, ev *goslackevents.AppMentionEvent, args []string) (string, error) {
+	return policy, nil
+}
+
+// whoOwnsCommand shows the usergroup matching a team channel
+func whoOwnsCommand(ctx context.Context, a *CerberusMention, ev *goslackevents.AppMentionEvent, args []string) (string, error) {
+	if len(args) != 1 {
+		return "Usage: `@cerberus who owns #channel`", nil
+	}
+
+	name := strings.TrimPrefix(args[0], "#")
+
+	if matches := channelRefRegexp.FindStringSubmatch(args[0]); matches != nil {
+		name = matches[2]
+
+		if len(name) == 0 {
+			ch, err := slack.GetConversationInfo(ctx, a.client, matches[1])
+
+			if err != nil {
+				return "", err
+			}
+
+			name = ch.Name
+		}
+	}
+
+	if !slack.IsTeamChannel(name) {
+		return fmt.Sprintf("#%s is not a team channel.", name), nil
+	}
+
+	handle := slack.TeamUserGroupHandle(name)
+	group, err := slack.GetUserGroup(ctx, a.client, handle)
+
+	if err != nil {
+		return "", err
+	}
+
+	if group == nil {
+		return fmt.Sprintf("#%s is not owned by anyone, there is no @%s usergroup.", name, handle), nil
+	}
+
+	return fmt.Sprintf("#%s is owned by <!subteam^%s> (%d members).", name, group.ID, len(group.Users)), nil
+}
+
+// pingCommand mentions a usergroup
+func pingCommand(ctx context.Context, a *CerberusMention, ev *goslackevents.AppMentionEvent, args []string) (string, error) {
+	if len(args) != 1 {
+		return "Usage: `@cerberus ping @usergroup`", nil
+	}
+
+	if matches := subteamRefRegexp.FindStringSubmatch(args[0]); matches != nil {
+		return fmt.Sprintf("<!subteam^%s> <@%s> is looking for you.", matches[1], ev.User), nil
+	}
+
+	handle := strings.TrimPrefix(args[0], "@")
+	group, err := slack.GetUserGroup(ctx, a.client, handle)
+
+	if err != nil {
+		return "", err
+	}
+
+	if group == nil {
+		return fmt.Sprintf("I don't know any @%s usergroup.", handle), nil
+	}
+
+	return fmt.Sprintf("<!subteam^%s> <@%s> is looking for you.", group.ID, ev.User), nil
+}
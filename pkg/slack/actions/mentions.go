@@ -1,12 +1,15 @@
 package actions
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
-	"net/url"
 	"strings"
+	"time"
 
 	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/audit"
+	"github.com/sylr/cerberus/pkg/logging"
+	"github.com/sylr/cerberus/pkg/membership"
 	"github.com/sylr/cerberus/pkg/slack"
 
 	log "github.com/sirupsen/logrus"
@@ -33,60 +36,113 @@ type CerberusMention struct {
 	client *goslack.Client
 }
 
-func (a *CerberusMention) Action(event interface{}) (bool, error) {
+// Name ...
+func (a *CerberusMention) Name() string {
+	return "cerberus_mention"
+}
+
+func (a *CerberusMention) Action(ctx context.Context, event interface{}) (bool, error) {
 	ev := event.(*goslackevents.AppMentionEvent)
+	logger := logging.FromContextOr(ctx, a.logger)
+
+	if throttled(ctx, a.client, logger, a.Name(), ev.User, ev.Channel, ev.TimeStamp) {
+		return false, nil
+	}
 
 	var msgOptions []goslack.MsgOption
 
-	// Thread
-	msgOptions = append(msgOptions, goslack.MsgOptionPostMessageParameters(goslack.PostMessageParameters{
-		ThreadTimestamp: ev.TimeStamp,
-	}))
+	// Thread, starting from the default parameters so that media, i.e. shared
+	// image files, are unfurled
+	params := goslack.NewPostMessageParameters()
+	params.ThreadTimestamp = ev.TimeStamp
+	msgOptions = append(msgOptions, goslack.MsgOptionPostMessageParameters(params))
+
+	if command, ok := ParseCommand(ev.Text); ok {
+		logger = logger.WithField("command", command.Name)
+		logger.Debugf("Command %q with args %q", command.Name, command.Args)
 
-	if a.config.CerberusMention == nil || len(a.config.CerberusMention.Messages) == 0 {
-		message := "wOOf wOOf"
-		msgOptions = append(msgOptions, goslack.MsgOptionText(message, false))
+		reply, err := lookupCommand(command.Name)(ctx, a, ev, command.Args)
+
+		if err != nil {
+			logger.Errorf("%s: %s", command.Name, err)
+			return false, err
+		}
+
+		msgOptions = append(msgOptions, goslack.MsgOptionText(reply, false))
 	} else {
-		index := rand.Intn(len(a.config.CerberusMention.Messages))
-		text := a.config.CerberusMention.Messages[index].Text
-		imageURL := a.config.CerberusMention.Messages[index].ImageURL
-
-		if len(imageURL) > 0 {
-			_, err := url.ParseRequestURI(imageURL)
-
-			if err != nil {
-				a.logger.Errorf("%s is not a valid url", imageURL)
-			} else {
-				var blockText *goslack.TextBlockObject
-
-				if len(text) > 0 {
-					blockText = goslack.NewTextBlockObject(goslack.PlainTextType, text, true, false)
-				} else {
-					blockText = goslack.NewTextBlockObject(goslack.PlainTextType, "w00f", true, false)
-				}
-
-				blockImage := goslack.NewImageBlock(imageURL, "w00f", "", blockText)
-				msgOptions = append(msgOptions, goslack.MsgOptionBlocks(blockImage))
-			}
-		} else if len(text) > 0 {
-			msgOptions = append(msgOptions, goslack.MsgOptionText(text, false))
-		} else {
-			return false, fmt.Errorf("No text or url for reply")
+		options, err := a.randomReply(ctx, logger, ev)
+
+		if err != nil {
+			return false, err
 		}
+
+		msgOptions = append(msgOptions, options...)
 	}
 
-	_, _, err := a.client.PostMessage(ev.Channel, msgOptions...)
+	_, _, err := a.client.PostMessageContext(ctx, ev.Channel, msgOptions...)
 
 	if err != nil {
-		a.logger.Errorf("PostMessage: %s", err)
+		logger.Errorf("PostMessage: %s", err)
 		return false, err
 	}
 
 	return true, nil
 }
 
+// randomReply returns the message options of a message selected among the
+// configured ones, "wOOf wOOf" if there is none. Image files are uploaded once
+// and shared by linking their permalink.
+func (a *CerberusMention) randomReply(ctx context.Context, logger *log.Entry, ev *goslackevents.AppMentionEvent) ([]goslack.MsgOption, error) {
+	var message *config.CerberusMentionMessage
+
+	if a.config.CerberusMention != nil {
+		message = SelectMessage(a.config.CerberusMention, ev, time.Now())
+	}
+
+	if message == nil {
+		return []goslack.MsgOption{goslack.MsgOptionText("wOOf wOOf", false)}, nil
+	}
+
+	text := message.Text
+	imageURL := message.ImageURL
+
+	if len(message.ImageFile) > 0 {
+		file, err := slack.UploadFile(ctx, a.client, a.config.Slack.Token, message.ImageFile)
+
+		if err != nil {
+			logger.Errorf("%s", err)
+			return nil, err
+		}
+
+		if len(text) > 0 {
+			text += "\n"
+		}
+
+		return []goslack.MsgOption{goslack.MsgOptionText(text+file.Permalink, false)}, nil
+	} else if len(imageURL) > 0 {
+		var blockText *goslack.TextBlockObject
+
+		if len(text) > 0 {
+			blockText = goslack.NewTextBlockObject(goslack.PlainTextType, text, true, false)
+		} else {
+			blockText = goslack.NewTextBlockObject(goslack.PlainTextType, "w00f", true, false)
+		}
+
+		blockImage := goslack.NewImageBlock(imageURL, "w00f", "", blockText)
+
+		return []goslack.MsgOption{goslack.MsgOptionBlocks(blockImage)}, nil
+	} else if len(text) > 0 {
+		return []goslack.MsgOption{goslack.MsgOptionText(text, false)}, nil
+	}
+
+	return nil, fmt.Errorf("No text or url for reply")
+}
+
 // -----------------------------------------------------------------------------
 
+// RuleTeamChannelAtChannel forbids @channel in team channels to non members
+const RuleTeamChannelAtChannel = "team_channel_at_channel"
+
 // NewAtChannelMention returns a new Actionner
 func NewAtChannelMention(conf *config.Cerberus, logger *log.Logger, client *goslack.Client) Actionner {
 	actionner := &AtChannelMention{
@@ -98,94 +154,140 @@ func NewAtChannelMention(conf *config.Cerberus, logger *log.Logger, client *gosl
 	return actionner
 }
 
+// AtChannelMention allows @channel in team channels only to the members of
+// the team, as told by the membership provider.
 type AtChannelMention struct {
 	config *config.Cerberus
 	logger *log.Logger
 	client *goslack.Client
 }
 
-func (a *AtChannelMention) Action(event interface{}) (bool, error) {
+// Name ...
+func (a *AtChannelMention) Name() string {
+	return "at_channel_mention"
+}
+
+func (a *AtChannelMention) Action(ctx context.Context, event interface{}) (bool, error) {
 	ev := event.(*goslackevents.MessageEvent)
+	logger := logging.FromContextOr(ctx, a.logger)
 
 	// Message does not contain @channel mention
 	if !strings.Contains(ev.Text, "<!channel>") {
-		a.logger.Debugf("Text does not contain <!channel>: %s", ev.Text)
+		logger.Debugf("Text does not contain <!channel>: %s", ev.Text)
 		return false, nil
 	}
 
-	ch, err := slack.GetConversationInfo(a.client, ev.Channel)
+	ch, err := slack.GetConversationInfo(ctx, a.client, ev.Channel)
 
 	if err != nil {
-		a.logger.Errorf("%s", err)
+		logger.Errorf("%s", err)
 		return false, err
 	}
 
+	logger = logger.WithField("rule", RuleTeamChannelAtChannel)
+
 	// Channel is not a team channel
-	if !strings.HasPrefix(ch.Name, "team-") {
-		a.logger.Debugf("#%s is not a team channel", ch.Name)
+	if !slack.IsTeamChannel(ch.Name) {
+		logger.Debugf("#%s is not a team channel", ch.Name)
 		return false, nil
 	} else {
-		a.logger.Debugf("#%s is a team channel", ch.Name)
+		logger.Debugf("#%s is a team channel", ch.Name)
 	}
 
-	user, err := slack.GetUserInfo(a.client, ev.User)
+	user, err := slack.GetUserInfo(ctx, a.client, ev.User)
 
 	if err != nil {
-		a.logger.Errorf("%s", err)
+		logger.Errorf("%s", err)
 		return false, err
 	}
 
 	// Channel creator
 	if ch.Creator == ev.User {
-		a.logger.Debugf("@%s is the channel creator", user.Name)
+		logger.Debugf("@%s is the channel creator", user.Name)
 		return false, nil
 	}
 
 	// User is Owner or Admin
 	if user.IsOwner || user.IsAdmin {
-		a.logger.Debugf("@%s is an admin or owner", user.Name)
+		logger.Debugf("@%s is an admin or owner", user.Name)
 		return false, nil
 	}
 
-	usergroup := strings.ReplaceAll(ch.Name, "-", "")
-	group, err := slack.GetUserGroup(a.client, usergroup)
+	handle := slack.TeamUserGroupHandle(ch.Name)
+	members, _, err := membership.Members(ctx, handle)
 
 	if err != nil {
-		a.logger.Errorf("%s", err)
+		logger.Errorf("%s", err)
 		return false, err
 	}
 
+	// User is a member of the team's channel team
+	if contains(members, ev.User) {
+		logger.Debugf("@%s is a member of @%s", ev.User, handle)
+		return false, nil
+	}
+
+	if throttled(ctx, a.client, logger, a.Name(), ev.User, ev.Channel, ev.TimeStamp) {
+		return false, nil
+	}
+
+	group, err := slack.GetUserGroup(ctx, a.client, handle)
+
+	if err != nil {
+		logger.Errorf("%s", err)
+		return false, err
+	}
+
+	// The team is mentioned through its usergroup if it has one
+	team := "@" + handle
+
 	if group != nil {
-		// User is a member of the team's channel team
-		for _, user := range group.Users {
-			if user == ev.User {
-				a.logger.Debugf("@%s is a member of @%s", ev.User, group.Handle)
-				return false, nil
-			}
-		}
+		team = fmt.Sprintf("<!subteam^%s>", group.ID)
 	}
 
-	format := "Hello <@%s> :wave:\nIt seems that you are not a member of <!subteam^%s> therefor you should not mention @channel in <#%s>.\n" +
-		"Please edit your message to use <!subteam^%s> to get the team's attention."
-	message := fmt.Sprintf(format, ev.User, group.ID, ev.Channel, group.ID)
-	channel, _, _, err := a.client.OpenConversation(&goslack.OpenConversationParameters{
+	format := "Hello <@%s> :wave:\nIt seems that you are not a member of %s therefor you should not mention @channel in <#%s>.\n" +
+		"Please edit your message to use %s to get the team's attention."
+	message := fmt.Sprintf(format, ev.User, team, ev.Channel, team)
+	channel, _, _, err := a.client.OpenConversationContext(ctx, &goslack.OpenConversationParameters{
 		Users: []string{ev.User},
 	})
 
 	if err != nil {
-		a.logger.Errorf("OpenConversation %s", err)
+		logger.Errorf("OpenConversation %s", err)
 		return false, err
 	}
 
-	_, _, err = a.client.PostMessage(
+	_, _, err = a.client.PostMessageContext(
+		ctx,
 		channel.ID,
 		goslack.MsgOptionText(message, false),
 	)
 
 	if err != nil {
-		a.logger.Errorf("PostMessage %s", err)
+		logger.Errorf("PostMessage %s", err)
 		return false, err
 	}
 
+	permalink, err := a.client.GetPermalinkContext(ctx, &goslack.PermalinkParameters{
+		Channel: ev.Channel,
+		Ts:      ev.TimeStamp,
+	})
+
+	if err != nil {
+		logger.Warnf("GetPermalink %s", err)
+	}
+
+	err = audit.Record(ctx, audit.Entry{
+		Action:    audit.ActionWarned,
+		Rule:      RuleTeamChannelAtChannel,
+		User:      ev.User,
+		Channel:   ev.Channel,
+		Permalink: permalink,
+	})
+
+	if err != nil {
+		logger.Errorf("%s", err)
+	}
+
 	return true, nil
 }
@@ -0,0 +1,287 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/audit"
+	"github.com/sylr/cerberus/pkg/logging"
+	"github.com/sylr/cerberus/pkg/slack"
+
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+)
+
+// RuleChannelNaming enforces the channel naming policy
+const RuleChannelNaming = "channel_naming"
+
+// maxChannelNameLength is the maximum length of Slack channel names
+const maxChannelNameLength = 80
+
+var invalidChannelNameRegexp = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// NewChannelNaming returns a new Actionner
+func NewChannelNaming(conf *config.Cerberus, logger *log.Logger, client *goslack.Client) Actionner {
+	actionner := &ChannelNaming{
+		config: conf,
+		logger: logger,
+		client: client,
+	}
+
+	if conf.ChannelNaming != nil && conf.ChannelNaming.Rename {
+		actionner.adminClient = slack.NewClient(&config.Slack{
+			Token:   conf.ChannelNaming.AdminToken,
+			Verbose: conf.Slack.Verbose,
+		})
+	}
+
+	return actionner
+}
+
+// ChannelNaming checks the names of created and renamed channels against the
+// naming policy.
+type ChannelNaming struct {
+	config      *config.Cerberus
+	logger      *log.Logger
+	client      *goslack.Client
+	adminClient *goslack.Client
+}
+
+// Name ...
+func (a *ChannelNaming) Name() string {
+	return "channel_naming"
+}
+
+func (a *ChannelNaming) Action(ctx context.Context, event interface{}) (bool, error) {
+	var channelID, name, verb, actor string
+
+	logger := logging.FromContextOr(ctx, a.logger)
+
+	if a.config.ChannelNaming == nil {
+		return false, nil
+	}
+
+	switch ev := event.(type) {
+	case *goslack.ChannelCreatedEvent:
+		channelID, name, verb = ev.Channel.ID, ev.Channel.Name, "created"
+
+		ch, err := slack.GetConversationInfo(ctx, a.client, channelID)
+
+		if err != nil {
+			logger.Errorf("%s", err)
+			return false, err
+		}
+
+		actor = ch.Creator
+	case *goslack.ChannelRenameEvent:
+		channelID, name, verb = ev.Channel.ID, ev.Channel.Name, "renamed"
+		// The event does not carry the renamer: when it is not found in the
+		// history nobody gets warned and the admin exemption does not apply
+		actor = a.renamer(ctx, logger, channelID, name)
+	default:
+		return false, fmt.Errorf("unexpected event %T", event)
+	}
+
+	admin := false
+
+	if len(actor) > 0 {
+		user, err := slack.GetUserInfo(ctx, a.client, actor)
+
+		if err != nil {
+			logger.Errorf("%s", err)
+			return false, err
+		}
+
+		admin = user.IsAdmin || user.IsOwner
+	}
+
+	logger = logger.WithField("rule", RuleChannelNaming)
+	policy := a.config.ChannelNaming
+	violations := channelNameViolations(policy, name, admin)
+
+	if len(violations) == 0 {
+		logger.Debugf("#%s complies with the naming policy", name)
+		return false, nil
+	}
+
+	suggestions := channelNameSuggestions(policy, name, admin)
+	text := fmt.Sprintf("Hello <@%s> :wave:\nThe name of <#%s> does not follow our channel naming policy:\n• %s",
+		actor, channelID, strings.Join(violations, "\n• "))
+
+	if len(suggestions) > 0 {
+		text += fmt.Sprintf("\nYou could rename it to `%s`.", strings.Join(suggestions, "`, `"))
+	}
+
+	// Rename
+	renamed := ""
+
+	if a.adminClient != nil && len(suggestions) > 0 {
+		if _, err := a.adminClient.RenameConversationContext(ctx, channelID, suggestions[0]); err != nil {
+			logger.Errorf("RenameConversation %s", err)
+		} else {
+			renamed = suggestions[0]
+			text += fmt.Sprintf("\nIt has been renamed to `%s`.", renamed)
+		}
+	}
+
+	// Creator or renamer
+	if len(actor) > 0 {
+		dm, _, _, err := a.client.OpenConversationContext(ctx, &goslack.OpenConversationParameters{
+			Users: []string{actor},
+		})
+
+		if err != nil {
+			logger.Errorf("OpenConversation %s", err)
+			return false, err
+		}
+
+		if _, _, err := a.client.PostMessageContext(ctx, dm.ID, goslack.MsgOptionText(text, false)); err != nil {
+			logger.Errorf("PostMessage %s", err)
+			return false, err
+		}
+
+		a.record(ctx, logger, audit.ActionWarned, actor, channelID)
+	}
+
+	if len(renamed) > 0 {
+		a.record(ctx, logger, audit.ActionRenamed, actor, channelID)
+	}
+
+	// Admins
+	if len(policy.AdminChannel) > 0 {
+		by := "an unknown user"
+
+		if len(actor) > 0 {
+			by = fmt.Sprintf("<@%s>", actor)
+		}
+
+		report := fmt.Sprintf("<#%s> (`%s`) %s by %s violates the naming policy: %s.",
+			channelID, name, verb, by, strings.Join(violations, ", "))
+
+		if len(renamed) > 0 {
+			report += fmt.Sprintf(" Renamed to `%s`.", renamed)
+		}
+
+		if _, _, err := a.client.PostMessageContext(ctx, policy.AdminChannel, goslack.MsgOptionText(report, false)); err != nil {
+			logger.Errorf("PostMessage %s", err)
+		}
+	}
+
+	return true, nil
+}
+
+// renamer returns the user who renamed channel to name according to the last
+// messages of channel, "" if not found
+func (a *ChannelNaming) renamer(ctx context.Context, logger *log.Entry, channel, name string) string {
+	history, err := a.client.GetConversationHistoryContext(ctx, &goslack.GetConversationHistoryParameters{
+		ChannelID: channel,
+		Limit:     20,
+	})
+
+	if err != nil {
+		logger.Warnf("GetConversationHistory %s", err)
+		return ""
+	}
+
+	for _, msg := range history.Messages {
+		if msg.SubType == "channel_name" && msg.Name == name {
+			return msg.User
+		}
+	}
+
+	return ""
+}
+
+// record records an enforcement decision of the naming rule
+func (a *ChannelNaming) record(ctx context.Context, logger *log.Entry, action, user, channel string) {
+	err := audit.Record(ctx, audit.Entry{
+		Action:  action,
+		Rule:    RuleChannelNaming,
+		User:    user,
+		Channel: channel,
+	})
+
+	if err != nil {
+		logger.Errorf("%s", err)
+	}
+}
+
+// channelNameViolations returns the reasons why name violates policy, admin
+// telling whether the channel was named by a workspace admin.
+func channelNameViolations(policy *config.ChannelNaming, name string, admin bool) []string {
+	var violations []string
+
+	if len(policy.Patterns) > 0 && !matchesAny(policy.Patterns, name) {
+		violations = append(violations, fmt.Sprintf("it should match one of `%s`", strings.Join(policy.Patterns, "`, `")))
+	}
+
+	if prefix := reservedPrefix(policy, name); !admin && len(prefix) > 0 {
+		violations = append(violations, fmt.Sprintf("the `%s` prefix is reserved to workspace admins", prefix))
+	}
+
+	return violations
+}
+
+// channelNameSuggestions returns the names complying with policy derived from
+// name, by normalizing it, dropping reserved prefixes and adding the literal
+// prefixes of the patterns.
+func channelNameSuggestions(policy *config.ChannelNaming, name string, admin bool) []string {
+	var suggestions []string
+
+	base := strings.Trim(invalidChannelNameRegexp.ReplaceAllString(strings.ToLower(name), "-"), "-")
+
+	if prefix := reservedPrefix(policy, base); !admin && len(prefix) > 0 {
+		base = strings.TrimPrefix(base, prefix)
+	}
+
+	candidates := []string{base}
+
+	for _, pattern := range policy.Patterns {
+		if i := strings.IndexAny(pattern, `*?[\`); i > 0 {
+			prefix := pattern[:i]
+			candidates = append(candidates, prefix+strings.TrimPrefix(base, prefix))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if len(candidate) > maxChannelNameLength {
+			candidate = strings.TrimRight(candidate[:maxChannelNameLength], "-")
+		}
+
+		if len(candidate) == 0 || candidate == name || contains(suggestions, candidate) {
+			continue
+		}
+
+		if len(channelNameViolations(policy, candidate, admin)) == 0 {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+
+	return suggestions
+}
+
+// reservedPrefix returns the reserved prefix of name, if any
+func reservedPrefix(policy *config.ChannelNaming, name string) string {
+	for _, prefix := range policy.ReservedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+// matchesAny reports whether name matches one of patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,152 @@
+package actions
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+
+	goslackevents "github.com/slack-go/slack/slackevents"
+)
+
+var (
+	// lastReplies are the last messages replied by channel, kept across
+	// config reloads for the non repeating selection
+	lastReplies   = make(map[string]string)
+	lastRepliesMu sync.Mutex
+)
+
+// SelectMessage returns the message replied to ev at now, or nil if no message
+// is eligible.
+func SelectMessage(conf *config.CerberusMention, ev *goslackevents.AppMentionEvent, now time.Time) *config.CerberusMentionMessage {
+	var candidates, triggered []*config.CerberusMentionMessage
+
+	for i := range conf.Messages {
+		message := &conf.Messages[i]
+
+		if !eligible(message, ev, now) {
+			continue
+		}
+
+		if len(message.Keywords) > 0 {
+			triggered = append(triggered, message)
+		} else {
+			candidates = append(candidates, message)
+		}
+	}
+
+	// Keyword triggered messages take precedence
+	if len(triggered) > 0 {
+		candidates = triggered
+	}
+
+	lastRepliesMu.Lock()
+	defer lastRepliesMu.Unlock()
+
+	if conf.Selection == "non_repeating" && len(candidates) > 1 {
+		var filtered []*config.CerberusMentionMessage
+
+		for _, message := range candidates {
+			if messageKey(message) != lastReplies[ev.Channel] {
+				filtered = append(filtered, message)
+			}
+		}
+
+		if len(filtered) > 0 {
+			candidates = filtered
+		}
+	}
+
+	message := weightedChoice(candidates)
+
+	if message != nil {
+		lastReplies[ev.Channel] = messageKey(message)
+	}
+
+	return message
+}
+
+// eligible reports whether the filters of message match ev at now
+func eligible(message *config.CerberusMentionMessage, ev *goslackevents.AppMentionEvent, now time.Time) bool {
+	if len(message.Channels) > 0 && !contains(message.Channels, ev.Channel) {
+		return false
+	}
+
+	if len(message.Users) > 0 && !contains(message.Users, ev.User) {
+		return false
+	}
+
+	if len(message.From) > 0 && !inSeason(message.From, message.To, now) {
+		return false
+	}
+
+	if len(message.Keywords) > 0 {
+		text := strings.ToLower(ev.Text)
+
+		for _, keyword := range message.Keywords {
+			if strings.Contains(text, strings.ToLower(keyword)) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// inSeason reports whether now is within the from/to "MM-DD" range, ranges
+// wrap around the new year if from is after to.
+func inSeason(from, to string, now time.Time) bool {
+	day := now.Format(config.MessageDateLayout)
+
+	if from <= to {
+		return from <= day && day <= to
+	}
+
+	return day >= from || day <= to
+}
+
+// weightedChoice returns a random message with a probability proportional to
+// its weight
+func weightedChoice(messages []*config.CerberusMentionMessage) *config.CerberusMentionMessage {
+	total := 0
+
+	for _, message := range messages {
+		total += message.Weight
+	}
+
+	if total <= 0 {
+		return nil
+	}
+
+	n := rand.Intn(total)
+
+	for _, message := range messages {
+		if n < message.Weight {
+			return message
+		}
+
+		n -= message.Weight
+	}
+
+	return nil
+}
+
+// messageKey identifies a message across config reloads
+func messageKey(message *config.CerberusMentionMessage) string {
+	return message.Text + "\x00" + message.ImageURL + "\x00" + message.ImageFile
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
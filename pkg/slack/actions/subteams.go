@@ -1,8 +1,13 @@
 package actions
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/logging"
 	"github.com/sylr/cerberus/pkg/slack"
+	"github.com/sylr/cerberus/pkg/usergroups"
 
 	log "github.com/sirupsen/logrus"
 	goslack "github.com/slack-go/slack"
@@ -25,10 +30,109 @@ type SubteamUpdated struct {
 	client *goslack.Client
 }
 
-func (a *SubteamUpdated) Action(event interface{}) (bool, error) {
+// Name ...
+func (a *SubteamUpdated) Name() string {
+	return "subteam_updated"
+}
+
+func (a *SubteamUpdated) Action(ctx context.Context, event interface{}) (bool, error) {
 	ev := event.(*goslack.SubteamUpdatedEvent)
 
 	slack.InvalidateGroupCache(ev.Subteam.Name)
 
 	return true, nil
 }
+
+// NewManagedUserGroup returns a new Actionner
+func NewManagedUserGroup(conf *config.Cerberus, logger *log.Logger, client *goslack.Client) Actionner {
+	actionner := &ManagedUserGroup{
+		config: conf,
+		logger: logger,
+		client: client,
+	}
+
+	return actionner
+}
+
+// ManagedUserGroup alerts when a usergroup managed by cerberus is changed by
+// someone else and drifts from its declaration.
+type ManagedUserGroup struct {
+	config *config.Cerberus
+	logger *log.Logger
+	client *goslack.Client
+}
+
+// Name ...
+func (a *ManagedUserGroup) Name() string {
+	return "managed_usergroup"
+}
+
+func (a *ManagedUserGroup) Action(ctx context.Context, event interface{}) (bool, error) {
+	ev := event.(*goslack.SubteamUpdatedEvent)
+	logger := logging.FromContextOr(ctx, a.logger)
+
+	if a.config.UserGroups == nil {
+		return false, nil
+	}
+
+	declared := a.config.UserGroups.Managed(ev.Subteam.Handle)
+
+	if declared == nil {
+		return false, nil
+	}
+
+	bot, err := slack.GetBotUserID(ctx, a.client, a.config.Slack.Token)
+
+	if err != nil {
+		logger.Errorf("%s", err)
+		return false, err
+	}
+
+	if ev.Subteam.UpdatedBy == bot {
+		logger.Debugf("@%s updated by cerberus", ev.Subteam.Handle)
+		return false, nil
+	}
+
+	group := ev.Subteam
+
+	if group.Users == nil {
+		if group.Users, err = a.client.GetUserGroupMembersContext(ctx, group.ID); err != nil {
+			logger.Errorf("GetUserGroupMembers %s", err)
+			return false, err
+		}
+	}
+
+	change, _, err := usergroups.Compare(ctx, a.client, *declared, &group)
+
+	if err != nil {
+		logger.Errorf("%s", err)
+		return false, err
+	}
+
+	if change.Empty() {
+		return false, nil
+	}
+
+	plan := usergroups.Plan{Changes: []usergroups.Change{change}}
+	logger.Warnf("@%s changed by %s drifted from its declaration", group.Handle, group.UpdatedBy)
+
+	if len(a.config.UserGroups.AlertChannel) == 0 {
+		return true, nil
+	}
+
+	text := fmt.Sprintf(":warning: <@%s> changed the managed usergroup @%s, syncing it back would take:\n```\n%s\n```",
+		group.UpdatedBy, group.Handle, plan.String())
+
+	if a.config.UserGroups.DryRun {
+		text += "\nDry run is enabled, the change will not be reverted."
+	} else {
+		text += "\nThe change will be reverted by the next sync, update the declaration to keep it."
+	}
+
+	if _, _, err := a.client.PostMessageContext(ctx, a.config.UserGroups.AlertChannel, goslack.MsgOptionText(text, false)); err != nil {
+		logger.Errorf("PostMessage %s", err)
+		return false, err
+	}
+
+	return true, nil
+}
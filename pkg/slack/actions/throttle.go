@@ -0,0 +1,45 @@
+package actions
+
+import (
+	"context"
+
+	"github.com/sylr/cerberus/pkg/throttle"
+
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+)
+
+// throttled reports whether action is throttled for user in channel. If so,
+// the action configured by the exceeded rule is done on the message ts: it is
+// reacted to every time, or replied to once per window.
+func throttled(ctx context.Context, client *goslack.Client, logger *log.Entry, action, user, channel, ts string) bool {
+	decision := throttle.Hit(ctx, action, user, channel)
+
+	if decision.Allowed {
+		return false
+	}
+
+	logger.Infof("Throttled by %s rule, %d runs per %s", decision.Rule.Scope, decision.Rule.Limit, decision.Rule.Window)
+
+	switch decision.Rule.OnLimit {
+	case "react":
+		if err := client.AddReactionContext(ctx, decision.Rule.Emoji, goslack.NewRefToMessage(channel, ts)); err != nil {
+			logger.Errorf("AddReaction %s", err)
+		}
+	case "reply":
+		if !decision.Notify {
+			break
+		}
+
+		_, _, err := client.PostMessageContext(ctx, channel,
+			goslack.MsgOptionText(decision.Rule.Message, false),
+			goslack.MsgOptionTS(ts),
+		)
+
+		if err != nil {
+			logger.Errorf("PostMessage %s", err)
+		}
+	}
+
+	return true
+}
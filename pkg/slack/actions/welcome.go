@@ -0,0 +1,349 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/logging"
+	"github.com/sylr/cerberus/pkg/slack"
+
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+	goslackevents "github.com/slack-go/slack/slackevents"
+)
+
+// Block action IDs of the welcome flow
+const (
+	welcomeJoinRequest = "welcome_member.join_request"
+	welcomeJoinApprove = "welcome_member.approve"
+	welcomeJoinDeny    = "welcome_member.deny"
+)
+
+var linkRegexp = regexp.MustCompile(`<https?://[^>]+>`)
+
+// WelcomeData is what welcome templates are rendered with
+type WelcomeData struct {
+	User            string
+	Channel         string
+	ChannelName     string
+	Purpose         string
+	UserGroupID     string
+	UserGroupHandle string
+	Pins            []string
+	Etiquette       string
+}
+
+// NewWelcomeMember returns a new Actionner
+func NewWelcomeMember(conf *config.Cerberus, logger *log.Logger, client *goslack.Client) Actionner {
+	actionner := &WelcomeMember{
+		config: conf,
+		logger: logger,
+		client: client,
+	}
+
+	return actionner
+}
+
+// WelcomeMember sends a direct message to the members joining channels
+// matching the welcome policy, optionally offering them to join the team's
+// usergroup.
+type WelcomeMember struct {
+	config *config.Cerberus
+	logger *log.Logger
+	client *goslack.Client
+}
+
+// Name ...
+func (a *WelcomeMember) Name() string {
+	return "welcome_member"
+}
+
+func (a *WelcomeMember) Action(ctx context.Context, event interface{}) (bool, error) {
+	ev := event.(*goslackevents.MemberJoinedChannelEvent)
+	logger := logging.FromContextOr(ctx, a.logger)
+
+	if a.config.Welcome == nil {
+		return false, nil
+	}
+
+	ch, err := slack.GetConversationInfo(ctx, a.client, ev.Channel)
+
+	if err != nil {
+		logger.Errorf("%s", err)
+		return false, err
+	}
+
+	if !matchesAny(a.config.Welcome.Channels, ch.Name) {
+		logger.Debugf("#%s does not match the welcome policy", ch.Name)
+		return false, nil
+	}
+
+	user, err := slack.GetUserInfo(ctx, a.client, ev.User)
+
+	if err != nil {
+		logger.Errorf("%s", err)
+		return false, err
+	}
+
+	if user.IsBot {
+		logger.Debugf("@%s is a bot", user.Name)
+		return false, nil
+	}
+
+	data := WelcomeData{
+		User:        ev.User,
+		Channel:     ev.Channel,
+		ChannelName: ch.Name,
+		Purpose:     ch.Purpose.Value,
+		Etiquette:   policy,
+	}
+
+	group, err := slack.GetUserGroup(ctx, a.client, slack.TeamUserGroupHandle(ch.Name))
+
+	if err != nil {
+		logger.Errorf("%s", err)
+		return false, err
+	}
+
+	if group != nil {
+		data.UserGroupID = group.ID
+		data.UserGroupHandle = group.Handle
+	}
+
+	if data.Pins, err = a.pinnedLinks(ctx, ev.Channel); err != nil {
+		logger.Warnf("ListPins %s", err)
+	}
+
+	text, err := renderWelcome(a.config.Welcome.Template, data)
+
+	if err != nil {
+		logger.Errorf("%s", err)
+		return false, err
+	}
+
+	blocks := []goslack.Block{
+		goslack.NewSectionBlock(goslack.NewTextBlockObject(goslack.MarkdownType, text, false, false), nil, nil),
+	}
+
+	if a.config.Welcome.JoinButton && group != nil && !contains(group.Users, ev.User) {
+		// Managed usergroups are synced with their declaration, which would
+		// undo approved requests
+		if a.managed(group.Handle) {
+			note := fmt.Sprintf("Members of @%s are declared in the cerberus configuration, ask its owners to add you there.", group.Handle)
+			blocks = append(blocks, goslack.NewContextBlock("", goslack.NewTextBlockObject(goslack.MarkdownType, note, false, false)))
+		} else {
+			button := goslack.NewButtonBlockElement(welcomeJoinRequest, group.ID+" "+ev.Channel,
+				goslack.NewTextBlockObject(goslack.PlainTextType, "Request to join @"+group.Handle, false, false))
+			blocks = append(blocks, goslack.NewActionBlock("", button))
+		}
+	}
+
+	channel, _, _, err := a.client.OpenConversationContext(ctx, &goslack.OpenConversationParameters{
+		Users: []string{ev.User},
+	})
+
+	if err != nil {
+		logger.Errorf("OpenConversation %s", err)
+		return false, err
+	}
+
+	_, _, err = a.client.PostMessageContext(ctx, channel.ID,
+		goslack.MsgOptionBlocks(blocks...),
+		goslack.MsgOptionText(text, false),
+	)
+
+	if err != nil {
+		logger.Errorf("PostMessage %s", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Interact handles the join requests: the newcomer's request is posted in the
+// channel, where one of the usergroup's owners approves or denies it.
+func (a *WelcomeMember) Interact(ctx context.Context, callback *goslack.InteractionCallback, action *goslack.BlockAction) (bool, error) {
+	logger := logging.FromContextOr(ctx, a.logger)
+	fields := strings.Fields(action.Value)
+
+	if len(fields) != 2 {
+		return false, fmt.Errorf("invalid value `%s`", action.Value)
+	}
+
+	groupID := fields[0]
+	group, err := slack.GetUserGroupByID(ctx, a.client, groupID)
+
+	if err != nil {
+		logger.Errorf("%s", err)
+		return false, err
+	}
+
+	if group == nil {
+		return false, fmt.Errorf("unknown usergroup `%s`", groupID)
+	}
+
+	// The usergroup was declared since the buttons were posted
+	if a.managed(group.Handle) {
+		a.replace(ctx, logger, callback, fmt.Sprintf("Members of @%s are declared in the cerberus configuration, join requests are not handled.", group.Handle))
+		return false, nil
+	}
+
+	switch action.ActionID {
+	case welcomeJoinRequest:
+		channel := fields[1]
+		owners := "Workspace admins"
+
+		if len(group.CreatedBy) > 0 {
+			owners = fmt.Sprintf("<@%s>", group.CreatedBy)
+		}
+
+		// The usergroup is named by handle so that its members are not notified
+		text := fmt.Sprintf("%s: <@%s> asks to join @%s.", owners, callback.User.ID, group.Handle)
+		approve := goslack.NewButtonBlockElement(welcomeJoinApprove, groupID+" "+callback.User.ID,
+			goslack.NewTextBlockObject(goslack.PlainTextType, "Approve", false, false)).WithStyle(goslack.StylePrimary)
+		deny := goslack.NewButtonBlockElement(welcomeJoinDeny, groupID+" "+callback.User.ID,
+			goslack.NewTextBlockObject(goslack.PlainTextType, "Deny", false, false)).WithStyle(goslack.StyleDanger)
+
+		_, _, err := a.client.PostMessageContext(ctx, channel,
+			goslack.MsgOptionBlocks(
+				goslack.NewSectionBlock(goslack.NewTextBlockObject(goslack.MarkdownType, text, false, false), nil, nil),
+				goslack.NewActionBlock("", approve, deny),
+			),
+			goslack.MsgOptionText(text, false),
+		)
+
+		if err != nil {
+			logger.Errorf("PostMessage %s", err)
+			return false, err
+		}
+
+		a.replace(ctx, logger, callback, fmt.Sprintf("Your request to join <!subteam^%s> has been sent to its owners in <#%s>.", groupID, channel))
+
+		return true, nil
+
+	case welcomeJoinApprove, welcomeJoinDeny:
+		requester := fields[1]
+		approver, err := slack.GetUserInfo(ctx, a.client, callback.User.ID)
+
+		if err != nil {
+			logger.Errorf("%s", err)
+			return false, err
+		}
+
+		// The owners of a usergroup are its creator and the workspace admins
+		if group.CreatedBy != approver.ID && !approver.IsAdmin && !approver.IsOwner {
+			_, err := a.client.PostEphemeralContext(ctx, callback.Channel.ID, callback.User.ID,
+				goslack.MsgOptionText(fmt.Sprintf("Only the owners of <!subteam^%s> can answer this request.", groupID), false))
+
+			if err != nil {
+				logger.Errorf("PostEphemeral %s", err)
+			}
+
+			return false, nil
+		}
+
+		verdict := "denied"
+
+		if action.ActionID == welcomeJoinApprove {
+			verdict = "approved"
+			members, err := a.client.GetUserGroupMembersContext(ctx, groupID)
+
+			if err != nil {
+				logger.Errorf("GetUserGroupMembers %s", err)
+				return false, err
+			}
+
+			if !contains(members, requester) {
+				members = append(members, requester)
+
+				if _, err := a.client.UpdateUserGroupMembersContext(ctx, groupID, strings.Join(members, ",")); err != nil {
+					logger.Errorf("UpdateUserGroupMembers %s", err)
+					return false, err
+				}
+			}
+
+			slack.InvalidateGroupCache(groupID)
+		}
+
+		a.replace(ctx, logger, callback, fmt.Sprintf("<@%s> asked to join @%s: %s by <@%s>.", requester, group.Handle, verdict, callback.User.ID))
+
+		channel, _, _, err := a.client.OpenConversationContext(ctx, &goslack.OpenConversationParameters{
+			Users: []string{requester},
+		})
+
+		if err == nil {
+			_, _, err = a.client.PostMessageContext(ctx, channel.ID,
+				goslack.MsgOptionText(fmt.Sprintf("Your request to join <!subteam^%s> has been %s by <@%s>.", groupID, verdict, callback.User.ID), false))
+		}
+
+		if err != nil {
+			logger.Errorf("PostMessage %s", err)
+		}
+
+		return true, nil
+	}
+
+	return false, fmt.Errorf("unknown action `%s`", action.ActionID)
+}
+
+// managed reports whether the usergroup handle is managed under usergroups
+func (a *WelcomeMember) managed(handle string) bool {
+	return a.config.UserGroups != nil && a.config.UserGroups.Managed(handle) != nil
+}
+
+// replace replaces the blocks of the message holding the buttons of callback
+// by text
+func (a *WelcomeMember) replace(ctx context.Context, logger *log.Entry, callback *goslack.InteractionCallback, text string) {
+	_, _, _, err := a.client.UpdateMessageContext(ctx, callback.Channel.ID, callback.Container.MessageTs,
+		goslack.MsgOptionBlocks(goslack.NewSectionBlock(goslack.NewTextBlockObject(goslack.MarkdownType, text, false, false), nil, nil)),
+		goslack.MsgOptionText(text, false),
+	)
+
+	if err != nil {
+		logger.Errorf("UpdateMessage %s", err)
+	}
+}
+
+// pinnedLinks returns the links of the items pinned in channel
+func (a *WelcomeMember) pinnedLinks(ctx context.Context, channel string) ([]string, error) {
+	var links []string
+
+	items, _, err := a.client.ListPinsContext(ctx, channel)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		switch {
+		case item.File != nil:
+			links = append(links, fmt.Sprintf("<%s|%s>", item.File.Permalink, item.File.Title))
+		case item.Message != nil:
+			links = append(links, linkRegexp.FindAllString(item.Message.Text, -1)...)
+		}
+	}
+
+	return links, nil
+}
+
+// renderWelcome renders the welcome template text with data
+func renderWelcome(text string, data WelcomeData) (string, error) {
+	tmpl, err := template.New("welcome").Parse(text)
+
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("welcome: %w", err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,57 @@
+package slack
+
+import (
+	"fmt"
+
+	goslack "github.com/slack-go/slack"
+)
+
+// maxSectionText is the length of the longest text Slack accepts in section
+// blocks
+const maxSectionText = 3000
+
+// CapLines returns the max first lines, followed by a line counting the other
+// ones if any.
+func CapLines(lines []string, max int) []string {
+	if len(lines) <= max {
+		return lines
+	}
+
+	capped := append([]string{}, lines[:max]...)
+
+	return append(capped, fmt.Sprintf("_and %d more_", len(lines)-max))
+}
+
+// MarkdownSections returns the markdown section blocks holding lines, as many
+// as needed for each of them to fit in a section.
+func MarkdownSections(lines []string) []goslack.Block {
+	var blocks []goslack.Block
+	var text string
+
+	flush := func() {
+		if len(text) > 0 {
+			blocks = append(blocks, goslack.NewSectionBlock(goslack.NewTextBlockObject(goslack.MarkdownType, text, false, false), nil, nil))
+			text = ""
+		}
+	}
+
+	for _, line := range lines {
+		if len(line) > maxSectionText {
+			line = line[:maxSectionText-3] + "..."
+		}
+
+		if len(text)+len(line)+1 > maxSectionText {
+			flush()
+		}
+
+		if len(text) > 0 {
+			text += "\n"
+		}
+
+		text += line
+	}
+
+	flush()
+
+	return blocks
+}
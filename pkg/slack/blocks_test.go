@@ -0,0 +1,89 @@
+package slack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	goslack "github.com/slack-go/slack"
+)
+
+func TestCapLines(t *testing.T) {
+	lines := []string{"a", "b", "c"}
+
+	tests := []struct {
+		max  int
+		want []string
+	}{
+		{max: 5, want: []string{"a", "b", "c"}},
+		{max: 3, want: []string{"a", "b", "c"}},
+		{max: 2, want: []string{"a", "b", "_and 1 more_"}},
+		{max: 0, want: []string{"_and 3 more_"}},
+	}
+
+	for _, test := range tests {
+		if got := CapLines(lines, test.max); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("CapLines(%d) = %q, want %q", test.max, got, test.want)
+		}
+	}
+
+	// The lines given are left untouched
+	CapLines(lines, 1)
+
+	if !reflect.DeepEqual(lines, []string{"a", "b", "c"}) {
+		t.Errorf("CapLines modified its input: %q", lines)
+	}
+}
+
+func TestMarkdownSections(t *testing.T) {
+	long := strings.Repeat("x", 2000)
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "single section",
+			lines: []string{"a", "b"},
+			want:  []string{"a\nb"},
+		},
+		{
+			name:  "split between lines",
+			lines: []string{long, long, "a"},
+			want:  []string{long, long + "\na"},
+		},
+		{
+			name:  "truncated line",
+			lines: []string{strings.Repeat("y", 4000)},
+			want:  []string{strings.Repeat("y", maxSectionText-3) + "..."},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+
+			for _, block := range MarkdownSections(test.lines) {
+				section := block.(*goslack.SectionBlock)
+
+				if section.Text.Type != goslack.MarkdownType {
+					t.Errorf("section type = %s, want %s", section.Text.Type, goslack.MarkdownType)
+				}
+
+				if len(section.Text.Text) > maxSectionText {
+					t.Errorf("section text length = %d, want at most %d", len(section.Text.Text), maxSectionText)
+				}
+
+				got = append(got, section.Text.Text)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("MarkdownSections() = %d sections, want %d", len(got), len(test.want))
+			}
+		})
+	}
+}
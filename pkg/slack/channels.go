@@ -1,7 +1,9 @@
 package slack
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	goslack "github.com/slack-go/slack"
@@ -12,14 +14,14 @@ var (
 	channelInfoCache = qdcache.GetMeteredCache(2*time.Minute, 2*time.Minute)
 )
 
-func GetConversationInfo(client *goslack.Client, channel string) (*goslack.Channel, error) {
+func GetConversationInfo(ctx context.Context, client *goslack.Client, channel string) (*goslack.Channel, error) {
 	cchan, found := channelInfoCache.Get(channel)
 
 	if found {
 		return cchan.(*goslack.Channel), nil
 	}
 
-	c, err := client.GetConversationInfo(channel, false)
+	c, err := client.GetConversationInfoContext(ctx, channel, false)
 
 	if err != nil {
 		return nil, fmt.Errorf("slack.GetConversationInfo: %w", err)
@@ -29,3 +31,76 @@ func GetConversationInfo(client *goslack.Client, channel string) (*goslack.Chann
 
 	return c, nil
 }
+
+// IsTeamChannel reports whether channel is a team channel, i.e. is prefixed by
+// "team-".
+func IsTeamChannel(channel string) bool {
+	return strings.HasPrefix(channel, "team-")
+}
+
+// TeamUserGroupHandle returns the handle of the usergroup matching a team
+// channel, "team-foo-bar" is matched by "@teamfoobar".
+func TeamUserGroupHandle(channel string) string {
+	return strings.ReplaceAll(channel, "-", "")
+}
+
+// GetTeamChannels returns the public, non archived, team channels.
+func GetTeamChannels(ctx context.Context, client *goslack.Client) ([]goslack.Channel, error) {
+	var channels []goslack.Channel
+
+	params := &goslack.GetConversationsParameters{
+		ExcludeArchived: "true",
+		Limit:           1000,
+		Types:           []string{"public_channel"},
+	}
+
+	for {
+		page, cursor, err := client.GetConversationsContext(ctx, params)
+
+		if err != nil {
+			return nil, fmt.Errorf("slack.GetTeamChannels: %w", err)
+		}
+
+		for _, channel := range page {
+			if IsTeamChannel(channel.Name) {
+				channels = append(channels, channel)
+			}
+		}
+
+		if len(cursor) == 0 {
+			break
+		}
+
+		params.Cursor = cursor
+	}
+
+	return channels, nil
+}
+
+// GetChannelMembers returns the IDs of the members of channel.
+func GetChannelMembers(ctx context.Context, client *goslack.Client, channel string) ([]string, error) {
+	var members []string
+
+	params := &goslack.GetUsersInConversationParameters{
+		ChannelID: channel,
+		Limit:     1000,
+	}
+
+	for {
+		page, cursor, err := client.GetUsersInConversationContext(ctx, params)
+
+		if err != nil {
+			return nil, fmt.Errorf("slack.GetChannelMembers: %w", err)
+		}
+
+		members = append(members, page...)
+
+		if len(cursor) == 0 {
+			break
+		}
+
+		params.Cursor = cursor
+	}
+
+	return members, nil
+}
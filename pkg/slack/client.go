@@ -1,15 +1,34 @@
 package slack
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
 	"github.com/sylr/cerberus/config"
 
 	goslack "github.com/slack-go/slack"
 )
 
-// NewClient returns a slack.Client
-func NewClient(conf *config.Slack) *goslack.Client {
-	return goslack.New(
-		conf.Token,
+// BaseTransport is the transport of the clients returned by NewClient,
+// http.DefaultTransport if nil. The replay command replaces it so that no
+// client reaches Slack.
+var BaseTransport http.RoundTripper
+
+// NewClient returns a slack.Client tracing and timing its API calls, options are applied
+// after the ones derived from conf.
+func NewClient(conf *config.Slack, options ...goslack.Option) *goslack.Client {
+	options = append([]goslack.Option{
 		goslack.OptionDebug(conf.Verbose),
-	)
+		goslack.OptionHTTPClient(&http.Client{Transport: NewTransport(BaseTransport)}),
+	}, options...)
+
+	return goslack.New(conf.Token, options...)
+}
+
+// tokenKey returns a cache key identifying the workspace and user token
+// authenticates as, without keeping the token itself in memory.
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
 }
@@ -0,0 +1,215 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// readOnlyMethods are the Slack Web API methods which do not modify
+	// anything and can be forwarded to Slack in read-only mode.
+	readOnlyMethods = map[string]bool{
+		"auth.test":             true,
+		"bots.info":             true,
+		"chat.getPermalink":     true,
+		"conversations.history": true,
+		"conversations.info":    true,
+		"conversations.list":    true,
+		"conversations.members": true,
+		"conversations.replies": true,
+		"files.info":            true,
+		"files.list":            true,
+		"pins.list":             true,
+		"team.info":             true,
+		"usergroups.list":       true,
+		"usergroups.users.list": true,
+		"users.info":            true,
+		"users.list":            true,
+		"users.lookupByEmail":   true,
+	}
+
+	// defaultResponses are answered to suppressed calls and to calls without
+	// fixture, they carry the fields callers dereference.
+	defaultResponses = map[string]string{
+		"chat.postMessage":        `{"ok":true,"channel":"C00000000","ts":"0000000000.000000"}`,
+		"chat.postEphemeral":      `{"ok":true,"message_ts":"0000000000.000000"}`,
+		"chat.update":             `{"ok":true,"channel":"C00000000","ts":"0000000000.000000"}`,
+		"conversations.open":      `{"ok":true,"channel":{"id":"D00000000"}}`,
+		"files.upload":            `{"ok":true,"file":{"id":"F00000000"}}`,
+		"reactions.add":           `{"ok":true}`,
+		"usergroups.create":       `{"ok":true,"usergroup":{"id":"S00000000"}}`,
+		"usergroups.enable":       `{"ok":true,"usergroup":{"id":"S00000000"}}`,
+		"usergroups.update":       `{"ok":true,"usergroup":{"id":"S00000000"}}`,
+		"usergroups.users.update": `{"ok":true,"usergroup":{"id":"S00000000"}}`,
+	}
+)
+
+// IsReadOnly reports whether the Slack Web API method does not modify anything.
+func IsReadOnly(method string) bool {
+	return readOnlyMethods[method]
+}
+
+// Call is a Slack Web API call seen by a Transport.
+type Call struct {
+	Method     string
+	Params     url.Values
+	Suppressed bool
+}
+
+// String implements fmt.Stringer, the token parameter is left out.
+func (c Call) String() string {
+	var keys, params []string
+
+	for key := range c.Params {
+		if key != "token" {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		params = append(params, fmt.Sprintf("%s=%q", key, c.Params.Get(key)))
+	}
+
+	if c.Suppressed {
+		return fmt.Sprintf("%s (suppressed) %s", c.Method, strings.Join(params, " "))
+	}
+
+	return fmt.Sprintf("%s %s", c.Method, strings.Join(params, " "))
+}
+
+// Transport is an http.RoundTripper standing for the Slack Web API. Calls are
+// answered from fixtures, or when a base http.RoundTripper is set, read-only
+// calls are forwarded to Slack and other calls are suppressed.
+type Transport struct {
+	fixtures map[string]json.RawMessage
+	base     http.RoundTripper
+	calls    []Call
+	mu       sync.Mutex
+}
+
+// New returns a *Transport answering calls from fixtures, which are indexed by
+// Slack Web API method.
+func New(fixtures map[string]json.RawMessage) *Transport {
+	return &Transport{
+		fixtures: fixtures,
+	}
+}
+
+// NewReadOnly returns a *Transport forwarding read-only calls to base and
+// suppressing the others.
+func NewReadOnly(base http.RoundTripper) *Transport {
+	return &Transport{
+		base: base,
+	}
+}
+
+// LoadFixtures reads a JSON object mapping Slack Web API methods to the
+// responses the fake backend must answer.
+func LoadFixtures(file string) (map[string]json.RawMessage, error) {
+	fixtures := make(map[string]json.RawMessage)
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &fixtures); err != nil {
+		return nil, fmt.Errorf("parsing fixtures %s: %w", file, err)
+	}
+
+	return fixtures, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	call := Call{
+		Method: method,
+		Params: requestParams(req),
+	}
+
+	if t.base != nil && IsReadOnly(method) {
+		t.record(call)
+		return t.base.RoundTrip(req)
+	}
+
+	var body string
+
+	if fixture, ok := t.fixtures[method]; ok && t.base == nil {
+		body = string(fixture)
+	} else if response, ok := defaultResponses[method]; ok {
+		body = response
+	} else if t.base != nil {
+		body = `{"ok":true}`
+	} else {
+		body = fmt.Sprintf(`{"ok":false,"error":"no fixture for %s"}`, method)
+	}
+
+	call.Suppressed = t.base != nil || !IsReadOnly(method)
+	t.record(call)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     http.StatusText(http.StatusOK),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// Calls returns the calls recorded since the last call to Calls.
+func (t *Transport) Calls() []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	calls := t.calls
+	t.calls = nil
+
+	return calls
+}
+
+func (t *Transport) record(call Call) {
+	t.mu.Lock()
+	t.calls = append(t.calls, call)
+	t.mu.Unlock()
+}
+
+// requestParams returns the form or query parameters of req, the body is
+// restored so that the request can still be forwarded.
+func requestParams(req *http.Request) url.Values {
+	params := req.URL.Query()
+
+	if req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return params
+	}
+
+	content, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(content))
+
+	if err != nil {
+		return params
+	}
+
+	form, err := url.ParseQuery(string(content))
+
+	if err != nil {
+		return params
+	}
+
+	for key, values := range form {
+		params[key] = values
+	}
+
+	return params
+}
@@ -0,0 +1,62 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	goslack "github.com/slack-go/slack"
+)
+
+// upload is a local file uploaded to Slack
+type upload struct {
+	modTime time.Time
+	size    int64
+	file    *goslack.File
+}
+
+var (
+	uploads   = make(map[string]upload)
+	uploadsMu sync.Mutex
+)
+
+// UploadFile uploads the local file path to Slack, without sharing it in any
+// channel, and returns it. The upload is reused by the clients of the same
+// token, the token of client, as long as the file is not modified.
+func UploadFile(ctx context.Context, client *goslack.Client, token, path string) (*goslack.File, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("slack.UploadFile: %w", err)
+	}
+
+	key := tokenKey(token) + ":" + path
+
+	uploadsMu.Lock()
+	u, found := uploads[key]
+	uploadsMu.Unlock()
+
+	if found && u.modTime.Equal(info.ModTime()) && u.size == info.Size() {
+		return u.file, nil
+	}
+
+	// Uploaded without holding the lock so that slow uploads do not hold the
+	// other replies, concurrent replies may upload the same file twice
+	file, err := client.UploadFileContext(ctx, goslack.FileUploadParameters{
+		File:     path,
+		Filename: filepath.Base(path),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("slack.UploadFile: %w", err)
+	}
+
+	uploadsMu.Lock()
+	uploads[key] = upload{modTime: info.ModTime(), size: info.Size(), file: file}
+	uploadsMu.Unlock()
+
+	return file, nil
+}
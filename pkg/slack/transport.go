@@ -0,0 +1,59 @@
+package slack
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/sylr/cerberus/pkg/tracing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricAPIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cerberus",
+			Subsystem: "slack_api",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of slack Web API calls",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method", "status"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricAPIRequestDuration)
+}
+
+// NewTransport returns an http.RoundTripper tracing and timing the slack Web
+// API calls made through base, http.DefaultTransport if nil.
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return tracing.NewTransport(&metricsTransport{base: base})
+}
+
+// metricsTransport observes the latency of slack Web API calls by method
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip ...
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	status := "error"
+
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+
+	metricAPIRequestDuration.WithLabelValues(path.Base(req.URL.Path), status).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
@@ -1,6 +1,7 @@
 package slack
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -18,8 +19,8 @@ func InvalidateGroupCache(usergroup string) {
 	userGroupMembersCache.Delete(usergroup)
 }
 
-func GetUserGroup(client *goslack.Client, usergroup string) (*goslack.UserGroup, error) {
-	groups, err := GetUserGroups(client)
+func GetUserGroup(ctx context.Context, client *goslack.Client, usergroup string) (*goslack.UserGroup, error) {
+	groups, err := GetUserGroups(ctx, client)
 
 	if err != nil {
 		return nil, fmt.Errorf("slack.GetUserGroup: %w", err)
@@ -34,14 +35,31 @@ func GetUserGroup(client *goslack.Client, usergroup string) (*goslack.UserGroup,
 	return nil, nil
 }
 
-func GetUserGroups(client *goslack.Client) ([]goslack.UserGroup, error) {
+// GetUserGroupByID returns the usergroup whose ID is id, nil if there is none
+func GetUserGroupByID(ctx context.Context, client *goslack.Client, id string) (*goslack.UserGroup, error) {
+	groups, err := GetUserGroups(ctx, client)
+
+	if err != nil {
+		return nil, fmt.Errorf("slack.GetUserGroupByID: %w", err)
+	}
+
+	for _, group := range groups {
+		if group.ID == id {
+			return &group, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func GetUserGroups(ctx context.Context, client *goslack.Client) ([]goslack.UserGroup, error) {
 	groups, found := userGroupsCache.Get("groups")
 
 	if found {
 		return groups.([]goslack.UserGroup), nil
 	}
 
-	groups, err := client.GetUserGroups(goslack.GetUserGroupsOptionIncludeUsers(true))
+	groups, err := client.GetUserGroupsContext(ctx, goslack.GetUserGroupsOptionIncludeUsers(true))
 
 	if err != nil {
 		return nil, fmt.Errorf("slack.GetUserGroups: %w", err)
@@ -52,14 +70,14 @@ func GetUserGroups(client *goslack.Client) ([]goslack.UserGroup, error) {
 	return groups.([]goslack.UserGroup), nil
 }
 
-func GetUserGroupMembers(client *goslack.Client, usergroup string) ([]string, error) {
+func GetUserGroupMembers(ctx context.Context, client *goslack.Client, usergroup string) ([]string, error) {
 	cmembers, found := userGroupMembersCache.Get(usergroup)
 
 	if found {
 		return cmembers.([]string), nil
 	}
 
-	members, err := client.GetUserGroupMembers(usergroup)
+	members, err := client.GetUserGroupMembersContext(ctx, usergroup)
 
 	if err != nil {
 		return nil, fmt.Errorf("slack.GetUserGroupMembers: %w", err)
@@ -1,7 +1,9 @@
 package slack
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	goslack "github.com/slack-go/slack"
@@ -12,14 +14,14 @@ var (
 	userInfoCache = qdcache.GetMeteredCache(2*time.Minute, 2*time.Minute)
 )
 
-func GetUserInfo(client *goslack.Client, user string) (*goslack.User, error) {
+func GetUserInfo(ctx context.Context, client *goslack.Client, user string) (*goslack.User, error) {
 	cuser, found := userInfoCache.Get(user)
 
 	if found {
 		return cuser.(*goslack.User), nil
 	}
 
-	u, err := client.GetUserInfo(user)
+	u, err := client.GetUserInfoContext(ctx, user)
 
 	if err != nil {
 		return nil, fmt.Errorf("slack.GetUserInfo: %w", err)
@@ -29,3 +31,99 @@ func GetUserInfo(client *goslack.Client, user string) (*goslack.User, error) {
 
 	return u, nil
 }
+
+func GetUserByEmail(ctx context.Context, client *goslack.Client, email string) (*goslack.User, error) {
+	cuser, found := userInfoCache.Get("email:" + email)
+
+	if found {
+		return cuser.(*goslack.User), nil
+	}
+
+	u, err := client.GetUserByEmailContext(ctx, email)
+
+	if err != nil {
+		return nil, fmt.Errorf("slack.GetUserByEmail: %w", err)
+	}
+
+	userInfoCache.Set("email:"+email, u, 0)
+
+	return u, nil
+}
+
+// GetBotUserID returns the ID of the user token, the token of client,
+// authenticates as
+func GetBotUserID(ctx context.Context, client *goslack.Client, token string) (string, error) {
+	key := "auth:" + tokenKey(token)
+	cuser, found := userInfoCache.Get(key)
+
+	if found {
+		return cuser.(string), nil
+	}
+
+	auth, err := client.AuthTestContext(ctx)
+
+	if err != nil {
+		return "", fmt.Errorf("slack.GetBotUserID: %w", err)
+	}
+
+	userInfoCache.Set(key, auth.UserID, 0)
+
+	return auth.UserID, nil
+}
+
+// getUsers returns the users of the workspace
+func getUsers(ctx context.Context, client *goslack.Client) ([]goslack.User, error) {
+	cusers, found := userInfoCache.Get("users")
+
+	if found {
+		return cusers.([]goslack.User), nil
+	}
+
+	users, err := client.GetUsersContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	userInfoCache.Set("users", users, 0)
+
+	return users, nil
+}
+
+// GetUserIDsByEmail returns the IDs of the active users of the workspace by
+// lowercased email
+func GetUserIDsByEmail(ctx context.Context, client *goslack.Client) (map[string]string, error) {
+	users, err := getUsers(ctx, client)
+
+	if err != nil {
+		return nil, fmt.Errorf("slack.GetUserIDsByEmail: %w", err)
+	}
+
+	ids := make(map[string]string, len(users))
+
+	for _, user := range users {
+		if !user.Deleted && len(user.Profile.Email) > 0 {
+			ids[strings.ToLower(user.Profile.Email)] = user.ID
+		}
+	}
+
+	return ids, nil
+}
+
+// GetUserNames returns the names of the users of the workspace by ID, so that
+// they can be named in messages without being notified.
+func GetUserNames(ctx context.Context, client *goslack.Client) (map[string]string, error) {
+	users, err := getUsers(ctx, client)
+
+	if err != nil {
+		return nil, fmt.Errorf("slack.GetUserNames: %w", err)
+	}
+
+	names := make(map[string]string, len(users))
+
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+
+	return names, nil
+}
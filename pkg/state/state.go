@@ -0,0 +1,243 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	metricStateFlushesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "state",
+			Name:      "flushes_total",
+			Help:      "Number of state store flushes",
+		},
+		[]string{"status"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricStateFlushesTotal)
+}
+
+// Store is a key/value store used by Cerberus components to keep state across
+// events and restarts. Writes are kept in memory and persisted to the store
+// file by Flush. A Store without file only keeps state in memory.
+type Store struct {
+	file   string
+	logger *log.Logger
+	values map[string]json.RawMessage
+	dirty  bool
+	done   chan struct{}
+	mu     sync.RWMutex
+}
+
+// New returns a *Store loaded from file. If file is empty the store is only
+// kept in memory.
+func New(file string, logger *log.Logger) (*Store, error) {
+	s := Store{
+		file:   file,
+		logger: logger,
+		values: make(map[string]json.RawMessage),
+	}
+
+	if len(file) == 0 {
+		return &s, nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &s, nil
+		}
+
+		return nil, fmt.Errorf("state.New: %w", err)
+	}
+
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &s.values); err != nil {
+			return nil, fmt.Errorf("state.New: %s: %w", file, err)
+		}
+	}
+
+	return &s, nil
+}
+
+// Get unmarshals the value stored under key into value and reports whether
+// the key was found.
+func (s *Store) Get(key string, value interface{}) (bool, error) {
+	s.mu.RLock()
+	raw, found := s.values[key]
+	s.mu.RUnlock()
+
+	if !found {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(raw, value); err != nil {
+		return true, fmt.Errorf("state.Get: %s: %w", key, err)
+	}
+
+	return true, nil
+}
+
+// Set stores value under key.
+func (s *Store) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+
+	if err != nil {
+		return fmt.Errorf("state.Set: %s: %w", key, err)
+	}
+
+	s.mu.Lock()
+	s.values[key] = raw
+	s.dirty = true
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Keys returns the sorted keys starting with prefix.
+func (s *Store) Keys(prefix string) []string {
+	var keys []string
+
+	s.mu.RLock()
+	for key := range s.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Delete removes key from the store.
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	if _, found := s.values[key]; found {
+		delete(s.values, key)
+		s.dirty = true
+	}
+	s.mu.Unlock()
+}
+
+// Flush persists the store to its file if it has been modified since the
+// last flush.
+func (s *Store) Flush() error {
+	if len(s.file) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	content, err := json.Marshal(s.values)
+
+	if err != nil {
+		metricStateFlushesTotal.WithLabelValues("error").Inc()
+		return fmt.Errorf("state.Flush: %w", err)
+	}
+
+	if err := writeFile(s.file, content); err != nil {
+		metricStateFlushesTotal.WithLabelValues("error").Inc()
+		return fmt.Errorf("state.Flush: %w", err)
+	}
+
+	s.dirty = false
+	metricStateFlushesTotal.WithLabelValues("success").Inc()
+
+	return nil
+}
+
+// Writable checks that the store file can be written.
+func (s *Store) Writable() error {
+	if len(s.file) == 0 {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.file), filepath.Base(s.file)+".*")
+
+	if err != nil {
+		return fmt.Errorf("state.Writable: %w", err)
+	}
+
+	tmp.Close()
+
+	return os.Remove(tmp.Name())
+}
+
+// Start flushes the store every interval until Close is called.
+func (s *Store) Start(interval time.Duration) {
+	if len(s.file) == 0 || interval <= 0 {
+		return
+	}
+
+	s.done = make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				if err := s.Flush(); err != nil {
+					s.logger.Errorf("%v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the periodic flush and flushes pending writes.
+func (s *Store) Close() error {
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+
+	return s.Flush()
+}
+
+// writeFile atomically replaces file with content.
+func writeFile(file string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
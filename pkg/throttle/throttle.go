@@ -0,0 +1,206 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/state"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	keyPrefix     = "throttle."
+	pruneInterval = time.Minute
+)
+
+var (
+	metricThrottledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "throttle",
+			Name:      "throttled_total",
+			Help:      "Number of action runs prevented by throttling rules",
+		},
+		[]string{"action", "scope"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricThrottledTotal)
+}
+
+// Decision is the outcome of a hit
+type Decision struct {
+	// Allowed reports whether the action may run
+	Allowed bool
+	// Rule is the rule exceeded if the action is not allowed
+	Rule *config.ThrottleRule
+	// Notify reports whether this is the first hit refused by Rule during
+	// the current window
+	Notify bool
+}
+
+// window counts the runs of a rule for a scope
+type window struct {
+	End      time.Time `json:"end"`
+	Count    int       `json:"count"`
+	Notified bool      `json:"notified"`
+}
+
+// Throttler counts the runs of actions in fixed windows persisted in the state
+// store, so that limits hold across restarts.
+type Throttler struct {
+	logger    *log.Logger
+	store     *state.Store
+	conf      *config.Throttle
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+// New returns a *Throttler, everything is allowed until Apply is called with a
+// non nil config.
+func New(logger *log.Logger, store *state.Store) *Throttler {
+	return &Throttler{
+		logger: logger,
+		store:  store,
+	}
+}
+
+// Apply replaces the throttling rules, a nil config disables throttling.
+// Rules are identified by their position so the windows persisted by a
+// previous config are reset, those persisted before a restart are kept.
+func (t *Throttler) Apply(conf *config.Throttle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conf != nil {
+		for _, key := range t.store.Keys(keyPrefix) {
+			t.store.Delete(key)
+		}
+	}
+
+	t.conf = conf.DeepCopy()
+}
+
+// Hit reports whether action may run for user in channel at now. If so, the
+// run is counted against all the rules applying to it.
+func (t *Throttler) Hit(action, user, channel string, now time.Time) Decision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conf == nil {
+		return Decision{Allowed: true}
+	}
+
+	if now.Sub(t.lastPrune) >= pruneInterval {
+		t.prune(now)
+		t.lastPrune = now
+	}
+
+	keys := make(map[string]window)
+
+	for i := range t.conf.Rules {
+		rule := &t.conf.Rules[i]
+
+		if !rule.AppliesTo(action) {
+			continue
+		}
+
+		key, ok := ruleKey(i, rule.Scope, user, channel)
+
+		if !ok {
+			continue
+		}
+
+		var w window
+
+		if _, err := t.store.Get(key, &w); err != nil {
+			t.logger.Errorf("throttle: %v", err)
+		}
+
+		if !now.Before(w.End) {
+			w = window{End: now.Add(rule.Window)}
+		}
+
+		if w.Count >= rule.Limit {
+			decision := Decision{Rule: rule, Notify: !w.Notified}
+			w.Notified = true
+			t.set(key, w)
+			metricThrottledTotal.WithLabelValues(action, rule.Scope).Inc()
+
+			return decision
+		}
+
+		w.Count++
+		keys[key] = w
+	}
+
+	for key, w := range keys {
+		t.set(key, w)
+	}
+
+	return Decision{Allowed: true}
+}
+
+// set stores w under key
+func (t *Throttler) set(key string, w window) {
+	if err := t.store.Set(key, w); err != nil {
+		t.logger.Errorf("throttle: %v", err)
+	}
+}
+
+// prune deletes the windows ended before now
+func (t *Throttler) prune(now time.Time) {
+	for _, key := range t.store.Keys(keyPrefix) {
+		var w window
+
+		if _, err := t.store.Get(key, &w); err != nil || !now.Before(w.End) {
+			t.store.Delete(key)
+		}
+	}
+}
+
+// ruleKey returns the store key of the window of rule i for user in channel, it
+// reports false if the scope is unknown or the event lacks it.
+func ruleKey(i int, scope, user, channel string) (string, bool) {
+	var id string
+
+	switch scope {
+	case "user":
+		id = user
+	case "channel":
+		id = channel
+	case "global":
+		return fmt.Sprintf("%s%d.global", keyPrefix, i), true
+	}
+
+	if len(id) == 0 {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s%d.%s.%s", keyPrefix, i, scope, id), true
+}
+
+type contextKey struct{}
+
+// WithThrottler returns a copy of ctx carrying t
+func WithThrottler(ctx context.Context, t *Throttler) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// Hit calls Hit on the throttler carried by ctx, everything is allowed if there
+// is none.
+func Hit(ctx context.Context, action, user, channel string) Decision {
+	t, ok := ctx.Value(contextKey{}).(*Throttler)
+
+	if !ok || t == nil {
+		return Decision{Allowed: true}
+	}
+
+	return t.Hit(action, user, channel, time.Now())
+}
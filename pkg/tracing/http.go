@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// statusRecorder keeps track of the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader ...
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Handler wraps handler so that each request is served within a server span
+// named name.
+func Handler(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := Tracer().Start(r.Context(), name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPTargetKey.String(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(recorder.status))
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(recorder.status))
+	})
+}
+
+// Transport is an http.RoundTripper creating a client span for each Slack Web
+// API call, carrying the API method, the HTTP status and rate limiting.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport returns a *Transport wrapping base, http.DefaultTransport if nil.
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		Base: base,
+	}
+}
+
+// RoundTrip ...
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	ctx, span := Tracer().Start(req.Context(), "slack "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("slack.method", method),
+			semconv.HTTPMethodKey.String(req.Method),
+		),
+	)
+	defer span.End()
+
+	resp, err := t.Base.RoundTrip(req.WithContext(ctx))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		span.SetAttributes(attribute.Bool("slack.rate_limited", true))
+
+		if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			span.SetAttributes(attribute.Int("slack.retry_after", retryAfter))
+		}
+	}
+
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+
+	if slackErr, failed := slackError(resp); failed {
+		span.SetAttributes(attribute.String("slack.error", slackErr))
+		span.SetStatus(codes.Error, slackErr)
+	}
+
+	return resp, nil
+}
+
+// slackError returns the error of Slack Web API responses whose ok field is
+// false. The body of resp is read and replaced so that it can be read again.
+func slackError(resp *http.Response) (string, bool) {
+	if resp.Body == nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return "", false
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(content), errReader{err}))
+		return "", false
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(content))
+
+	body := struct {
+		OK    *bool  `json:"ok"`
+		Error string `json:"error"`
+	}{}
+
+	if err := json.Unmarshal(content, &body); err != nil || body.OK == nil || *body.OK {
+		return "", false
+	}
+
+	return body.Error, true
+}
+
+// errReader is an io.Reader failing with err
+type errReader struct {
+	err error
+}
+
+// Read ...
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// roundTripper answers every request with a response of status and body, or
+// fails with err
+type roundTripper struct {
+	status int
+	header http.Header
+	body   string
+	err    error
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.err != nil {
+		return nil, rt.err
+	}
+
+	header := http.Header{"Content-Type": []string{"application/json; charset=utf-8"}}
+
+	for key, values := range rt.header {
+		header[key] = values
+	}
+
+	return &http.Response{
+		StatusCode: rt.status,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(rt.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestTransport(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing := New(log.New())
+
+	if err := tracing.UseExporter(context.Background(), exporter); err != nil {
+		t.Fatal(err)
+	}
+
+	defer tracing.Shutdown(context.Background())
+
+	tests := []struct {
+		name       string
+		base       roundTripper
+		wantAttrs  map[attribute.Key]attribute.Value
+		wantStatus codes.Code
+	}{
+		{
+			name: "ok",
+			base: roundTripper{status: http.StatusOK, body: `{"ok":true}`},
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"slack.method":     attribute.StringValue("chat.postMessage"),
+				"http.status_code": attribute.IntValue(http.StatusOK),
+			},
+			wantStatus: codes.Unset,
+		},
+		{
+			name: "slack error",
+			base: roundTripper{status: http.StatusOK, body: `{"ok":false,"error":"channel_not_found"}`},
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"slack.method": attribute.StringValue("chat.postMessage"),
+				"slack.error":  attribute.StringValue("channel_not_found"),
+			},
+			wantStatus: codes.Error,
+		},
+		{
+			name: "rate limited",
+			base: roundTripper{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": []string{"30"}}, body: `{"ok":false,"error":"ratelimited"}`},
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"http.status_code":   attribute.IntValue(http.StatusTooManyRequests),
+				"slack.rate_limited": attribute.BoolValue(true),
+				"slack.retry_after":  attribute.IntValue(30),
+			},
+			wantStatus: codes.Error,
+		},
+		{
+			name: "transport error",
+			base: roundTripper{err: errors.New("connection refused")},
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"slack.method": attribute.StringValue("chat.postMessage"),
+			},
+			wantStatus: codes.Error,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exporter.Reset()
+
+			req, _ := http.NewRequest(http.MethodPost, "https://slack.com/api/chat.postMessage", nil)
+			resp, err := NewTransport(test.base).RoundTrip(req)
+
+			if (err != nil) != (test.base.err != nil) {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+
+			// The body is still readable after being inspected
+			if resp != nil {
+				if body, _ := ioutil.ReadAll(resp.Body); string(body) != test.base.body {
+					t.Errorf("body = %s, want %s", body, test.base.body)
+				}
+			}
+
+			spans := exporter.GetSpans()
+
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+
+			span := spans[0]
+
+			if span.Name != "slack chat.postMessage" {
+				t.Errorf("span name = %s, want slack chat.postMessage", span.Name)
+			}
+
+			attrs := make(map[attribute.Key]attribute.Value)
+
+			for _, kv := range span.Attributes {
+				attrs[kv.Key] = kv.Value
+			}
+
+			for key, want := range test.wantAttrs {
+				if got, ok := attrs[key]; !ok || got != want {
+					t.Errorf("attribute %s = %v, want %v", key, got.Emit(), want.Emit())
+				}
+			}
+
+			if span.Status.Code != test.wantStatus {
+				t.Errorf("status = %v, want %v", span.Status.Code, test.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sylr/cerberus/config"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/sylr/cerberus"
+
+// Tracer returns the tracer cerberus spans are created with. It must not be
+// kept around as the tracer provider is replaced on config reloads.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Tracing owns the global tracer provider.
+type Tracing struct {
+	logger   *log.Logger
+	provider *sdktrace.TracerProvider
+	mu       sync.Mutex
+}
+
+// New returns a *Tracing, spans are not exported until Apply is called with a
+// non nil config.
+func New(logger *log.Logger) *Tracing {
+	return &Tracing{
+		logger: logger,
+	}
+}
+
+// Apply replaces the tracer provider with one exporting spans as configured by
+// conf, a nil config disables tracing.
+func (t *Tracing) Apply(ctx context.Context, conf *config.Tracing) error {
+	if conf == nil {
+		return t.swap(ctx, nil)
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch conf.Exporter {
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	default:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(conf.Endpoint)}
+
+		if conf.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(ctx, options...)
+	}
+
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRate))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(conf.ServiceName))),
+	)
+
+	return t.swap(ctx, provider)
+}
+
+// UseExporter replaces the tracer provider with one synchronously exporting
+// every span to exporter, e.g. a tracetest.InMemoryExporter.
+func (t *Tracing) UseExporter(ctx context.Context, exporter sdktrace.SpanExporter) error {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+
+	return t.swap(ctx, provider)
+}
+
+// Shutdown flushes the pending spans and disables tracing.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	return t.swap(ctx, nil)
+}
+
+// swap installs provider as the global tracer provider and shuts down the
+// previous one. A nil provider disables tracing.
+func (t *Tracing) swap(ctx context.Context, provider *sdktrace.TracerProvider) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if provider != nil {
+		otel.SetTracerProvider(provider)
+	} else {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	}
+
+	previous := t.provider
+	t.provider = provider
+
+	if previous != nil {
+		if err := previous.Shutdown(ctx); err != nil {
+			return fmt.Errorf("tracing: %w", err)
+		}
+	}
+
+	return nil
+}
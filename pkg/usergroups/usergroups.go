@@ -0,0 +1,458 @@
+package usergroups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/membership"
+	"github.com/sylr/cerberus/pkg/scheduler"
+	"github.com/sylr/cerberus/pkg/slack"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	goslack "github.com/slack-go/slack"
+)
+
+var (
+	metricPendingChanges = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "usergroups_sync",
+			Name:      "pending_changes",
+			Help:      "Number of managed usergroups differing from their declaration at the last sync",
+		},
+	)
+
+	metricAppliedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "usergroups_sync",
+			Name:      "applied_total",
+			Help:      "Number of usergroup changes applied by status",
+		},
+		[]string{"status"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricPendingChanges)
+	prometheus.MustRegister(metricAppliedTotal)
+	scheduler.Register("usergroups_sync", newJob)
+}
+
+// Field is a usergroup attribute to update
+type Field struct {
+	Name string
+	From string
+	To   string
+}
+
+// Change is what it takes for a usergroup to match its declaration
+type Change struct {
+	Handle string
+	// Group is the current usergroup, nil if it has to be created
+	Group *goslack.UserGroup
+	// Desired is the usergroup as declared
+	Desired goslack.UserGroup
+	// Members are the IDs of the declared members
+	Members []string
+	// Labels are the declared emails of members by ID
+	Labels  map[string]string
+	Enable  bool
+	Fields  []Field
+	Added   []string
+	Removed []string
+}
+
+// Create reports whether the usergroup does not exist yet
+func (c *Change) Create() bool {
+	return c.Group == nil
+}
+
+// Empty reports whether the usergroup already matches its declaration
+func (c *Change) Empty() bool {
+	return !c.Create() && !c.Enable && len(c.Fields) == 0 && len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// Plan is the set of changes syncing Slack with the declared usergroups
+type Plan struct {
+	Changes []Change
+	// Warnings are the declared members which could not be resolved
+	Warnings []string
+}
+
+// Empty reports whether Slack already matches the declared usergroups
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// String renders the plan as a diff
+func (p *Plan) String() string {
+	var lines []string
+
+	for _, warning := range p.Warnings {
+		lines = append(lines, "! "+warning)
+	}
+
+	for _, change := range p.Changes {
+		switch {
+		case change.Create():
+			lines = append(lines, fmt.Sprintf("+ @%s (create)", change.Handle))
+			lines = append(lines, fmt.Sprintf("    name: %q", change.Desired.Name))
+
+			if len(change.Desired.Description) > 0 {
+				lines = append(lines, fmt.Sprintf("    description: %q", change.Desired.Description))
+			}
+
+			if len(change.Desired.Prefs.Channels) > 0 {
+				lines = append(lines, fmt.Sprintf("    channels: %s", strings.Join(change.Desired.Prefs.Channels, ", ")))
+			}
+		case change.Enable:
+			lines = append(lines, fmt.Sprintf("~ @%s (enable)", change.Handle))
+		default:
+			lines = append(lines, fmt.Sprintf("~ @%s", change.Handle))
+		}
+
+		for _, field := range change.Fields {
+			lines = append(lines, fmt.Sprintf("    %s: %q => %q", field.Name, field.From, field.To))
+		}
+
+		for _, user := range change.Added {
+			lines = append(lines, "    + "+change.label(user))
+		}
+
+		for _, user := range change.Removed {
+			lines = append(lines, "    - "+change.label(user))
+		}
+	}
+
+	if len(lines) == 0 {
+		return "No changes, usergroups are up to date."
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// label returns user followed by its declared email, if any
+func (c *Change) label(user string) string {
+	if email, ok := c.Labels[user]; ok {
+		return fmt.Sprintf("%s (%s)", user, email)
+	}
+
+	return user
+}
+
+// NewPlan compares the declared usergroups with the ones of the workspace,
+// disabled ones included. The members of sourced usergroups are looked up in
+// the membership provider carried by ctx.
+func NewPlan(ctx context.Context, client *goslack.Client, conf *config.UserGroups) (Plan, error) {
+	var plan Plan
+
+	groups, err := client.GetUserGroupsContext(ctx,
+		goslack.GetUserGroupsOptionIncludeDisabled(true),
+		goslack.GetUserGroupsOptionIncludeUsers(true),
+	)
+
+	if err != nil {
+		return plan, fmt.Errorf("usergroups: GetUserGroups: %w", err)
+	}
+
+	byHandle := make(map[string]*goslack.UserGroup, len(groups))
+
+	for i := range groups {
+		byHandle[groups[i].Handle] = &groups[i]
+	}
+
+	for _, declared := range conf.Groups {
+		change, warnings, err := Compare(ctx, client, declared, byHandle[declared.Handle])
+
+		if err != nil {
+			return plan, err
+		}
+
+		plan.Warnings = append(plan.Warnings, warnings...)
+
+		if change.Create() && len(change.Members) == 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("@%s: not created without members", declared.Handle))
+			continue
+		}
+
+		if !change.Empty() {
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+
+	return plan, nil
+}
+
+// Compare returns the change making group match its declaration, group being
+// nil if it does not exist. Declared members which are not Slack users and
+// unknown sources are returned as warnings and left out.
+func Compare(ctx context.Context, client *goslack.Client, declared config.UserGroup, group *goslack.UserGroup) (Change, []string, error) {
+	change := Change{
+		Handle: declared.Handle,
+		Group:  group,
+		Desired: goslack.UserGroup{
+			Handle:      declared.Handle,
+			Name:        declared.Name,
+			Description: declared.Description,
+			Prefs:       goslack.UserGroupPrefs{Channels: declared.Channels},
+		},
+		Labels: make(map[string]string),
+	}
+
+	members, warnings, err := resolveMembers(ctx, client, declared, change.Labels)
+
+	if err != nil {
+		return change, warnings, err
+	}
+
+	change.Members = members
+
+	if group == nil {
+		change.Added = members
+		return change, warnings, nil
+	}
+
+	change.Desired.ID = group.ID
+	change.Enable = group.DateDelete != 0
+
+	if group.Name != declared.Name {
+		change.Fields = append(change.Fields, Field{Name: "name", From: group.Name, To: declared.Name})
+	}
+
+	// Empty descriptions and channels are not managed, Slack ignores them
+	if len(declared.Description) > 0 && group.Description != declared.Description {
+		change.Fields = append(change.Fields, Field{Name: "description", From: group.Description, To: declared.Description})
+	}
+
+	if len(declared.Channels) > 0 && !sameSet(group.Prefs.Channels, declared.Channels) {
+		change.Fields = append(change.Fields, Field{
+			Name: "channels",
+			From: strings.Join(group.Prefs.Channels, ","),
+			To:   strings.Join(declared.Channels, ","),
+		})
+	}
+
+	// Members of a group whose members could not be resolved are left as is
+	if len(members) == 0 {
+		return change, warnings, nil
+	}
+
+	change.Added = difference(members, group.Users)
+	change.Removed = difference(group.Users, members)
+
+	return change, warnings, nil
+}
+
+// resolveMembers returns the user IDs of the members of declared, looking up
+// emails and the members of its source. labels is filled with the emails by
+// user ID.
+func resolveMembers(ctx context.Context, client *goslack.Client, declared config.UserGroup, labels map[string]string) ([]string, []string, error) {
+	var members, warnings []string
+
+	if len(declared.Source) > 0 {
+		sourced, found, err := membership.Members(ctx, declared.Source)
+
+		if err != nil {
+			return nil, warnings, fmt.Errorf("usergroups: @%s: %w", declared.Handle, err)
+		}
+
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("@%s: unknown source team %s", declared.Handle, declared.Source))
+		}
+
+		for _, member := range sourced {
+			if !contains(members, member) {
+				members = append(members, member)
+			}
+		}
+	}
+
+	for _, member := range declared.Members {
+		if !strings.Contains(member, "@") {
+			if !contains(members, member) {
+				members = append(members, member)
+			}
+
+			continue
+		}
+
+		user, err := slack.GetUserByEmail(ctx, client, member)
+
+		if err != nil {
+			// slack-go reports API errors as plain errors
+			if errors.Unwrap(err) != nil && errors.Unwrap(err).Error() == "users_not_found" {
+				warnings = append(warnings, fmt.Sprintf("@%s: no Slack user with email %s", declared.Handle, member))
+				continue
+			}
+
+			return nil, warnings, fmt.Errorf("usergroups: @%s: %w", declared.Handle, err)
+		}
+
+		if user.Deleted {
+			warnings = append(warnings, fmt.Sprintf("@%s: %s is deactivated", declared.Handle, member))
+			continue
+		}
+
+		labels[user.ID] = member
+
+		if !contains(members, user.ID) {
+			members = append(members, user.ID)
+		}
+	}
+
+	return members, warnings, nil
+}
+
+// Apply applies the changes of plan, going on with the next usergroup when one
+// fails. It returns the number of usergroups changed.
+func Apply(ctx context.Context, client *goslack.Client, plan Plan, logger *log.Logger) (int, error) {
+	var errs []string
+	applied := 0
+
+	for _, change := range plan.Changes {
+		if err := apply(ctx, client, change); err != nil {
+			logger.Errorf("usergroups: @%s: %v", change.Handle, err)
+			metricAppliedTotal.WithLabelValues("error").Inc()
+			errs = append(errs, "@"+change.Handle)
+			continue
+		}
+
+		logger.Infof("usergroups: @%s synced", change.Handle)
+		metricAppliedTotal.WithLabelValues("success").Inc()
+		applied++
+	}
+
+	if applied > 0 {
+		slack.InvalidateGroupCache("")
+	}
+
+	if len(errs) > 0 {
+		return applied, fmt.Errorf("usergroups: failed to sync %s", strings.Join(errs, ", "))
+	}
+
+	return applied, nil
+}
+
+// apply applies change
+func apply(ctx context.Context, client *goslack.Client, change Change) error {
+	id := change.Desired.ID
+
+	switch {
+	case change.Create():
+		group, err := client.CreateUserGroupContext(ctx, change.Desired)
+
+		if err != nil {
+			return fmt.Errorf("CreateUserGroup: %w", err)
+		}
+
+		id = group.ID
+	case change.Enable:
+		if _, err := client.EnableUserGroupContext(ctx, id); err != nil {
+			return fmt.Errorf("EnableUserGroup: %w", err)
+		}
+	}
+
+	if len(change.Fields) > 0 {
+		if _, err := client.UpdateUserGroupContext(ctx, change.Desired); err != nil {
+			return fmt.Errorf("UpdateUserGroup: %w", err)
+		}
+	}
+
+	if len(change.Added) > 0 || len(change.Removed) > 0 {
+		if _, err := client.UpdateUserGroupMembersContext(ctx, id, strings.Join(change.Members, ",")); err != nil {
+			return fmt.Errorf("UpdateUserGroupMembers: %w", err)
+		}
+
+		slack.InvalidateGroupCache(id)
+	}
+
+	return nil
+}
+
+// job syncs the declared usergroups
+type job struct {
+	conf   *config.UserGroups
+	logger *log.Logger
+	client *goslack.Client
+}
+
+// newJob returns the job syncing the usergroups declared in conf
+func newJob(conf *config.Cerberus, logger *log.Logger) (scheduler.Job, error) {
+	if conf.UserGroups == nil {
+		return nil, fmt.Errorf("no usergroups section")
+	}
+
+	j := job{
+		conf:   conf.UserGroups.DeepCopy(),
+		logger: logger,
+		client: slack.NewClient(&conf.Slack),
+	}
+
+	return &j, nil
+}
+
+// Run ...
+func (j *job) Run(ctx context.Context) error {
+	plan, err := NewPlan(ctx, j.client, j.conf)
+
+	if err != nil {
+		return err
+	}
+
+	for _, warning := range plan.Warnings {
+		j.logger.Warnf("usergroups: %s", warning)
+	}
+
+	metricPendingChanges.Set(float64(len(plan.Changes)))
+
+	if plan.Empty() {
+		return nil
+	}
+
+	if j.conf.DryRun {
+		j.logger.Infof("usergroups: dry run, not applying:\n%s", plan.String())
+		return nil
+	}
+
+	applied, err := Apply(ctx, j.client, plan, j.logger)
+	metricPendingChanges.Set(float64(len(plan.Changes) - applied))
+
+	return err
+}
+
+// sameSet reports whether a and b hold the same values
+func sameSet(a, b []string) bool {
+	return len(difference(a, b)) == 0 && len(difference(b, a)) == 0
+}
+
+// difference returns the values of a which are not in b, sorted
+func difference(a, b []string) []string {
+	var diff []string
+
+	for _, v := range a {
+		if !contains(b, v) {
+			diff = append(diff, v)
+		}
+	}
+
+	sort.Strings(diff)
+
+	return diff
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,192 @@
+package usergroups
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/sylr/cerberus/config"
+	"github.com/sylr/cerberus/pkg/membership"
+	"github.com/sylr/cerberus/pkg/slack/fake"
+
+	goslack "github.com/slack-go/slack"
+)
+
+// teams is a membership.MembershipProvider answering from a map
+type teams map[string][]string
+
+func (t teams) Members(ctx context.Context, team string) ([]string, bool, error) {
+	members, found := t[team]
+	return members, found, nil
+}
+
+func TestCompare(t *testing.T) {
+	client := goslack.New("xoxb-test", goslack.OptionHTTPClient(&http.Client{
+		Transport: fake.New(map[string]json.RawMessage{
+			"users.lookupByEmail": json.RawMessage(`{"ok":true,"user":{"id":"U3"}}`),
+		}),
+	}))
+	ctx := membership.WithProvider(context.Background(), teams{"ops": {"U4", "U1"}})
+
+	tests := []struct {
+		name         string
+		declared     config.UserGroup
+		group        *goslack.UserGroup
+		wantCreate   bool
+		wantEnable   bool
+		wantFields   []Field
+		wantAdded    []string
+		wantRemoved  []string
+		wantWarnings []string
+	}{
+		{
+			name:       "missing",
+			declared:   config.UserGroup{Handle: "sre", Name: "SRE", Members: []string{"U1", "U2"}},
+			wantCreate: true,
+			wantAdded:  []string{"U1", "U2"},
+		},
+		{
+			name:     "up to date",
+			declared: config.UserGroup{Handle: "sre", Name: "SRE", Members: []string{"U1", "U2"}},
+			group:    &goslack.UserGroup{ID: "S1", Handle: "sre", Name: "SRE", Users: []string{"U2", "U1"}},
+		},
+		{
+			name:        "members",
+			declared:    config.UserGroup{Handle: "sre", Name: "SRE", Members: []string{"U1", "U2"}},
+			group:       &goslack.UserGroup{ID: "S1", Handle: "sre", Name: "SRE", Users: []string{"U1", "U9"}},
+			wantAdded:   []string{"U2"},
+			wantRemoved: []string{"U9"},
+		},
+		{
+			name:     "fields",
+			declared: config.UserGroup{Handle: "sre", Name: "SRE", Description: "On call", Channels: []string{"C1", "C2"}, Members: []string{"U1"}},
+			group:    &goslack.UserGroup{ID: "S1", Handle: "sre", Name: "Ops", Prefs: goslack.UserGroupPrefs{Channels: []string{"C1"}}, Users: []string{"U1"}},
+			wantFields: []Field{
+				{Name: "name", From: "Ops", To: "SRE"},
+				{Name: "description", From: "", To: "On call"},
+				{Name: "channels", From: "C1", To: "C1,C2"},
+			},
+		},
+		{
+			name:     "unmanaged description and channels",
+			declared: config.UserGroup{Handle: "sre", Name: "SRE", Members: []string{"U1"}},
+			group:    &goslack.UserGroup{ID: "S1", Handle: "sre", Name: "SRE", Description: "On call", Prefs: goslack.UserGroupPrefs{Channels: []string{"C1"}}, Users: []string{"U1"}},
+		},
+		{
+			name:       "disabled",
+			declared:   config.UserGroup{Handle: "sre", Name: "SRE", Members: []string{"U1"}},
+			group:      &goslack.UserGroup{ID: "S1", Handle: "sre", Name: "SRE", DateDelete: 1, Users: []string{"U1"}},
+			wantEnable: true,
+		},
+		{
+			name:      "email and source",
+			declared:  config.UserGroup{Handle: "sre", Name: "SRE", Source: "ops", Members: []string{"U1", "jane@example.com"}},
+			group:     &goslack.UserGroup{ID: "S1", Handle: "sre", Name: "SRE", Users: []string{"U1"}},
+			wantAdded: []string{"U3", "U4"},
+		},
+		{
+			name:         "unknown source",
+			declared:     config.UserGroup{Handle: "sre", Name: "SRE", Source: "dev"},
+			group:        &goslack.UserGroup{ID: "S1", Handle: "sre", Name: "SRE", Users: []string{"U1"}},
+			wantWarnings: []string{"@sre: unknown source team dev"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			change, warnings, err := Compare(ctx, client, test.declared, test.group)
+
+			if err != nil {
+				t.Fatalf("Compare() error = %v", err)
+			}
+
+			if change.Create() != test.wantCreate {
+				t.Errorf("Create() = %v, want %v", change.Create(), test.wantCreate)
+			}
+
+			if change.Enable != test.wantEnable {
+				t.Errorf("Enable = %v, want %v", change.Enable, test.wantEnable)
+			}
+
+			if !reflect.DeepEqual(change.Fields, test.wantFields) {
+				t.Errorf("Fields = %+v, want %+v", change.Fields, test.wantFields)
+			}
+
+			if !reflect.DeepEqual(change.Added, test.wantAdded) {
+				t.Errorf("Added = %q, want %q", change.Added, test.wantAdded)
+			}
+
+			if !reflect.DeepEqual(change.Removed, test.wantRemoved) {
+				t.Errorf("Removed = %q, want %q", change.Removed, test.wantRemoved)
+			}
+
+			if !reflect.DeepEqual(warnings, test.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, test.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestPlanString(t *testing.T) {
+	tests := []struct {
+		name string
+		plan Plan
+		want string
+	}{
+		{
+			name: "empty",
+			want: "No changes, usergroups are up to date.",
+		},
+		{
+			name: "create",
+			plan: Plan{Changes: []Change{{
+				Handle:  "sre",
+				Desired: goslack.UserGroup{Name: "SRE", Description: "On call", Prefs: goslack.UserGroupPrefs{Channels: []string{"C1", "C2"}}},
+				Labels:  map[string]string{"U3": "jane@example.com"},
+				Added:   []string{"U1", "U3"},
+			}}},
+			want: `+ @sre (create)
+    name: "SRE"
+    description: "On call"
+    channels: C1, C2
+    + U1
+    + U3 (jane@example.com)`,
+		},
+		{
+			name: "update",
+			plan: Plan{
+				Warnings: []string{"@ops: no Slack user with email john@example.com"},
+				Changes: []Change{
+					{
+						Handle:  "sre",
+						Group:   &goslack.UserGroup{ID: "S1"},
+						Fields:  []Field{{Name: "name", From: "Ops", To: "SRE"}},
+						Added:   []string{"U2"},
+						Removed: []string{"U9"},
+					},
+					{
+						Handle: "ops",
+						Group:  &goslack.UserGroup{ID: "S2"},
+						Enable: true,
+					},
+				},
+			},
+			want: `! @ops: no Slack user with email john@example.com
+~ @sre
+    name: "Ops" => "SRE"
+    + U2
+    - U9
+~ @ops (enable)`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.plan.String(); got != test.want {
+				t.Errorf("String() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
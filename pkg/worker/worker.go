@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when the queue is full.
+	ErrQueueFull = errors.New("worker queue is full")
+	// ErrClosed is returned by Submit once Shutdown has been called.
+	ErrClosed = errors.New("worker pool is closed")
+)
+
+var (
+	metricWorkerQueueLength = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cerberus",
+			Subsystem: "worker",
+			Name:      "queue_length",
+			Help:      "Number of jobs waiting in the worker queue",
+		},
+		[]string{},
+	)
+
+	metricWorkerRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerberus",
+			Subsystem: "worker",
+			Name:      "rejected_total",
+			Help:      "Number of jobs rejected by the worker queue",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(metricWorkerQueueLength)
+	prometheus.MustRegister(metricWorkerRejectedTotal)
+}
+
+// Pool runs submitted jobs with a fixed number of workers.
+type Pool struct {
+	logger *log.Logger
+	queue  chan func()
+	closed bool
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+}
+
+// New returns a *Pool of count workers consuming a queue of size jobs.
+func New(count int, size int, logger *log.Logger) *Pool {
+	p := Pool{
+		logger: logger,
+		queue:  make(chan func(), size),
+	}
+
+	for i := 0; i < count; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+
+	return &p
+}
+
+// Submit enqueues job, it never blocks.
+func (p *Pool) Submit(job func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		metricWorkerRejectedTotal.WithLabelValues("closed").Inc()
+		return ErrClosed
+	}
+
+	select {
+	case p.queue <- job:
+		metricWorkerQueueLength.WithLabelValues().Inc()
+		return nil
+	default:
+		metricWorkerRejectedTotal.WithLabelValues("full").Inc()
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting jobs and waits for queued jobs to be processed or
+// for ctx to be done.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for job := range p.queue {
+		metricWorkerQueueLength.WithLabelValues().Dec()
+		p.run(job)
+	}
+}
+
+// run executes job and recovers from its panics so that a faulty job does not
+// kill the worker.
+func (p *Pool) run(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.logger.Errorf("worker: recovered from panic: %v", r)
+		}
+	}()
+
+	job()
+}